@@ -18,37 +18,60 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/unixdj/ussssr/reactor"
 )
 
 var conf = struct {
 	cmd      []string
+	backends []string
+	replay   []string
+	triggers []*reactor.Trigger
+	helper   []string
+	policy   reactor.Policy
 	delay    time.Duration
+	grace    time.Duration
+	interval time.Duration
+	busy     reactor.BusyPolicy
+	onTime   reactor.TimeoutAction
+	idle     time.Duration
+	window   time.Duration
+	notify   []string
+	confirm  []string
+	check    []string
+	fallback [][]string
+	failExit bool
+	failure  reactor.FailurePolicy
+	failNote []string
+	relaunch bool
+	unlocked int
+	track    bool
 	bg       bool
+	pass     bool
+	ready    int
+	list     bool
+	lid      bool
+	x11      bool
+	docked   bool
 	debug    bool
-	logLevel int
 }{
-	logLevel: 1,
-	delay:    defaultDelay,
+	delay:  reactor.DefaultDelay,
+	grace:  reactor.DefaultGrace,
+	window: 10 * time.Second,
 }
 
-// logging
-
-func loglnAt(ll int, v ...interface{}) {
-	if conf.logLevel >= ll {
-		log.Println(v...)
-	}
-}
-
-func logln(v ...interface{})   { loglnAt(1, v...) }
-func debugln(v ...interface{}) { loglnAt(2, v...) }
-
 // command line flags
 
 type durFlag struct{ *time.Duration }
@@ -73,14 +96,24 @@ func (d durFlag) Set(s string) error {
 	return nil
 }
 
+// command splits s into a command and its arguments, rejecting an
+// empty command.
+func command(s string) ([]string, error) {
+	args := strings.Fields(s)
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return args, nil
+}
+
 func printHelp(long bool) {
 	w := flag.CommandLine.Output()
 	if long {
 		io.WriteString(w,
 			`USSSSR - UPower/Systemd Screen Saving Sleep Reactor
 
-USSSSR runs a command when a UPower or systemd sleep (suspend,
-hibernate) event is received on D-Bus.
+USSSSR runs a command when a UPower, systemd or ConsoleKit2 sleep
+(suspend, hibernate) event is received on D-Bus.
 
 When a sleep signal is received, if the command is not running,
 it is started.  If a foreground command exits with status 0
@@ -93,6 +126,120 @@ unlocked (such as "slock") should be run in the background, a
 command that exits immediately (such as "xset s activate" or
 "xscreensaver -lock") in the foreground.
 
+A foreground command still running at the timeout is left alone
+by default, and sleep events are ignored until it exits.  With
+"-on-timeout term", it's sent SIGTERM, and with "-on-timeout
+kill", also SIGKILL after a grace period given by -kill-after.
+
+Sleep and lock events received while a foreground command is
+running are swallowed by default.  With "-on-busy coalesce", the
+command is run once more after it exits (for sleep, only before
+wakeup or the timeout), and with "-on-busy restart" it's sent
+SIGTERM (and SIGKILL after the grace period) and run again.  A
+running background command keeps the screen locked, so events are
+always swallowed.  With -min-interval, runs are at least that far
+apart, events in between being swallowed or deferred likewise.
+
+With -confirm or -confirm-check, the sleep inhibit lock is held
+until the screen lock is confirmed rather than for the delay after
+the command exits, but no longer than the timeout.  The sources
+given to -confirm are "screensaver", the screen saver's
+ActiveChanged signal on the session bus, and "session", the
+LockedHint of the logind session.  -confirm-check runs a command
+repeatedly until it exits with status 0.  A sleep without
+confirmation is logged.
+
+With -transfer-sleep-lock, a command run upon sleep gets a
+duplicate of the systemd or ConsoleKit2 sleep inhibit lock file
+descriptor, its number given in $XSS_SLEEP_LOCK_FD, as with
+xss-lock.  Sleep waits until the command closes it, signalling
+that the screen is locked, and the delay passes.  Only use it
+with screen lockers supporting this, such as i3lock.
+
+With -ready-fd, the command gets the write end of a pipe as the
+given file descriptor, its number also in $USSSSR_READY_FD, and
+writes a newline to it when the screen is locked, as with s6
+readiness notification.  The sleep inhibit lock is then released
+without waiting for the delay or the command to exit.  With -b,
+it's held until then, up to the timeout, rather than the delay.
+
+With -fallback, which can be given more than once, another
+locker (command or built-in action) is tried if the command can't
+be started, or exits with non-zero status before the sleep
+inhibit lock is released, and so on down the list.  If all of
+them fail, it's logged, and with -exit-on-failure USSSSR exits
+with status 3.  Otherwise, -on-failure decides: "release" (the
+default) releases the sleep inhibit lock, "hold" holds it until
+the timeout while retrying the lockers, "block" does the same,
+but also blocks sleep until a locker succeeds and runs the
+command given with -failure-notify.
+
+With -relaunch, a background locker that dies while the screen
+should be locked, killed or exiting with non-zero status other
+than the one given with -unlock-status, is relaunched at once.
+The screen stops being deemed locked when the locker exits
+normally, or the logind session's LockedHint is cleared.
+If it dies more than five times in a minute, USSSSR exits.
+
+With -track, the command is run in its own process group and
+USSSSR becomes a child subreaper, adopting processes orphaned by
+the command, so that a command that forks and exits, leaving the
+locker running, is deemed running until all of its descendants
+exit.  Such a command should be run in the background.
+
+Built-in actions, given instead of the command, lock the screen
+without running a program: "logind:lock-session" asks logind to
+lock the session, "freedesktop-screensaver:lock",
+"gnome-screensaver:lock" and "kde:lock" ask the screen saver over
+D-Bus, and "x11:activate" activates the X screen saver like "xset
+s activate".  They complete when the request is done, and should
+be run in the foreground.
+
+Backends are tried in order, by default systemd, ConsoleKit2,
+UPower, xdg-desktop-portal, acpid, then evdev.  A
+comma-separated list of backends can be given with -backend.
+The policy given with -policy determines which of them are used:
+"first" uses the first available one, "any" all available ones,
+"all" requires all of them to be available.  -list-backends
+reports whether each backend is usable, and if not, why.
+
+The evdev backend reads input devices with a lid switch or a sleep
+key directly.  With -evdev-replay, it reads recorded input_event
+streams (e.g., copied from /dev/input/event*) from files instead,
+and exits when they end.
+
+With -lid, the command is also run when the lid is closed, even
+if the system doesn't go to sleep.  With -lid-docked, this only
+happens while the system is docked.
+
+With -idle, the command is also run when logind reports the
+session idle (IdleHint) for the given duration.  This relies on
+the desktop environment or the screen saver setting the hint.
+With -notify, a notifier command (e.g., notify-send) is run
+-notify-before (by default 10 seconds) before the idle lock; if
+the session becomes active in between, the lock is cancelled and
+the notifier killed.  Sleep locks immediately, without notifying.
+
+With -x11, the command is also run when the X screen saver is
+activated, as reported by the MIT-SCREEN-SAVER extension.
+
+With -trigger, the command is run upon a user-defined D-Bus
+signal, given as "BUS;RULE;PREDICATES;EVENT": BUS is "system" or
+"session", RULE a D-Bus match rule, PREDICATES a comma-separated,
+possibly empty, list of conditions on signal arguments such as
+"arg0==true" or "arg1!=foo", and EVENT "lock", "sleep" or
+"wakeup".  E.g.:
+
+  -trigger "system;type='signal',interface='com.example.Dock',member='Changed';arg0==false;lock"
+
+With -external, events are received from a helper command, which
+writes JSON objects such as {"event":"sleep"} ("sleep", "wakeup",
+"lock" or "unlock") to its standard output, one per line, and
+receives acknowledgements such as {"ack":"released"} and
+{"ack":"command finished"} on its standard input.  The helper is
+restarted if it exits.  "-backend none" uses no backend besides
+those given by -lid, -idle, -x11, -trigger and -external.
+
 Delay can be specified in seconds (e.g., "0.5") or in any format
 accepted by time.ParseDuration (e.g., "500ms").
 
@@ -117,13 +264,126 @@ func usage() {
 
 func parseFlags() {
 	flag.Var(durFlag{&conf.delay}, "d", "`delay` after command")
+	flag.Func("on-timeout", "foreground command timeout `action`:"+
+		" keep, term or kill", func(s string) (err error) {
+		conf.onTime, err = reactor.ParseTimeoutAction(s)
+		return
+	})
+	flag.Func("on-busy", "`policy` for events while command is"+
+		" running: swallow, coalesce or restart",
+		func(s string) (err error) {
+			conf.busy, err = reactor.ParseBusyPolicy(s)
+			return
+		})
+	flag.Var(durFlag{&conf.interval}, "min-interval",
+		"minimum `interval` between command runs")
+	flag.Var(durFlag{&conf.grace}, "kill-after",
+		"`delay` between SIGTERM and SIGKILL on timeout")
 	flag.BoolVar(&conf.bg, "b", false, "run command in the background")
+	flag.Func("backend", "comma-separated `list` of backends",
+		func(s string) error {
+			conf.backends = strings.Split(s, ",")
+			return nil
+		})
+	flag.Func("policy", "backend `policy`: first, any or all",
+		func(s string) (err error) {
+			conf.policy, err = reactor.ParsePolicy(s)
+			return
+		})
+	flag.Func("trigger", "lock or sleep upon user-defined D-Bus `signal`"+
+		" (repeatable)", func(s string) error {
+		t, err := reactor.ParseTrigger(s)
+		if err == nil {
+			conf.triggers = append(conf.triggers, t)
+		}
+		return err
+	})
+	flag.Func("external", "receive events from helper `command`",
+		func(s string) (err error) {
+			conf.helper, err = command(s)
+			return
+		})
+	flag.Var(durFlag{&conf.idle}, "idle",
+		"lock after the session has been idle for `duration`")
+	flag.Func("notify", "run notifier `command` before idle lock",
+		func(s string) error {
+			conf.notify = strings.Fields(s)
+			return nil
+		})
+	flag.Var(durFlag{&conf.window}, "notify-before",
+		"run notifier `duration` before idle lock")
+	flag.Func("confirm", "await lock confirmation from comma-separated"+
+		" `sources` (screensaver, session)", func(s string) error {
+		for _, v := range strings.Split(s, ",") {
+			switch v {
+			case "screensaver", "session":
+			default:
+				return fmt.Errorf("unknown source %q", v)
+			}
+		}
+		conf.confirm = strings.Split(s, ",")
+		return nil
+	})
+	flag.Func("confirm-check", "await lock confirmation by `command`"+
+		" exiting with status 0", func(s string) (err error) {
+		conf.check, err = command(s)
+		return
+	})
+	flag.BoolVar(&conf.pass, "transfer-sleep-lock", false,
+		"pass sleep inhibit lock fd to command via XSS_SLEEP_LOCK_FD")
+	flag.Func("ready-fd", "pass readiness pipe to command as `fd`",
+		func(s string) (err error) {
+			conf.ready, err = strconv.Atoi(s)
+			if err == nil && conf.ready < 3 {
+				err = errors.New("fd must be 3 or more")
+			}
+			return
+		})
+	flag.Func("fallback", "run fallback locker `command` if the"+
+		" command fails (repeatable)", func(s string) error {
+		args, err := command(s)
+		if err == nil {
+			conf.fallback = append(conf.fallback, args)
+		}
+		return err
+	})
+	flag.BoolVar(&conf.failExit, "exit-on-failure", false,
+		"exit with status 3 if all lockers fail")
+	flag.Func("on-failure", "failure `policy`: release, hold or block",
+		func(s string) (err error) {
+			conf.failure, err = reactor.ParseFailurePolicy(s)
+			return
+		})
+	flag.Func("failure-notify", "run `command` when sleep is blocked",
+		func(s string) error {
+			conf.failNote = strings.Fields(s)
+			return nil
+		})
+	flag.BoolVar(&conf.relaunch, "relaunch", false,
+		"relaunch background locker if it dies")
+	flag.IntVar(&conf.unlocked, "unlock-status", 0,
+		"locker exit `status` meaning the user unlocked")
+	flag.BoolVar(&conf.track, "track", false,
+		"track descendants of command until they all exit (Linux)")
+	flag.BoolVar(&conf.x11, "x11", false,
+		"lock when the X screen saver is activated")
+	flag.BoolVar(&conf.lid, "lid", false, "lock when the lid is closed")
+	flag.BoolVar(&conf.docked, "lid-docked", false,
+		"lock when the lid is closed while docked")
+	flag.BoolVar(&conf.list, "list-backends", false,
+		"probe backends and exit")
 	flag.BoolVar(&conf.debug, "debug", false,
 		"use debug backend (non-functional)")
+	flag.Func("evdev-replay",
+		"use evdev backend reading comma-separated `files`",
+		func(s string) error {
+			conf.replay = strings.Split(s, ",")
+			return nil
+		})
 	flag.BoolFunc("q", "quiet",
-		func(string) error { conf.logLevel--; return nil })
+		func(string) error { reactor.LogLevel--; return nil })
 	flag.BoolFunc("v", "verbose",
-		func(string) error { conf.logLevel++; return nil })
+		func(string) error { reactor.LogLevel++; return nil })
 	flag.BoolFunc("h", "short help",
 		func(string) error { help(false); return nil })
 	flag.BoolFunc("help", "long help",
@@ -131,15 +391,184 @@ func parseFlags() {
 	flag.Usage = usage
 	flag.Parse()
 	conf.cmd = flag.Args()
-	if len(conf.cmd) == 0 {
+	if conf.pass && conf.ready == 3 {
+		fmt.Fprintln(flag.CommandLine.Output(),
+			"-ready-fd 3 conflicts with -transfer-sleep-lock")
+		os.Exit(2)
+	}
+	if len(conf.cmd) == 0 && !conf.list {
 		printHelp(false)
 		os.Exit(2)
 	}
 }
 
+// listBackends probes the selected backends and reports whether
+// they are usable.  It exits with status 0 if any is.
+func listBackends(ctx context.Context) {
+	names := conf.backends
+	if len(names) == 0 {
+		names = reactor.Backends()
+	}
+	errs, err := reactor.Probe(ctx, names)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	status := 1
+	for i, err := range errs {
+		if err == nil {
+			status = 0
+			os.Stdout.WriteString(names[i] + ": usable\n")
+		} else {
+			os.Stdout.WriteString(names[i] + ": " + err.Error() + "\n")
+		}
+	}
+	os.Exit(status)
+}
+
+// openBackend returns the backend.
+func openBackend(ctx context.Context) (reactor.Backend, error) {
+	if conf.debug {
+		return reactor.NewDebugBackend(os.Stdin), nil
+	} else if conf.replay != nil {
+		return reactor.NewEvdevReplayBackend(conf.replay)
+	}
+	var bes []reactor.Backend
+	add := func(what string, be reactor.Backend, err error) error {
+		if err != nil {
+			for _, v := range bes {
+				v.Close()
+			}
+			return fmt.Errorf("%s: %w", what, err)
+		}
+		bes = append(bes, be)
+		return nil
+	}
+	if len(conf.backends) != 1 || conf.backends[0] != "none" {
+		be, err := reactor.Open(ctx, conf.backends, conf.policy)
+		if err != nil {
+			return nil, err
+		}
+		bes = append(bes, be)
+	}
+	if conf.lid || conf.docked {
+		be, err := reactor.NewLidBackend(ctx, conf.docked)
+		if err := add("lid", be, err); err != nil {
+			return nil, err
+		}
+	}
+	if conf.idle > 0 {
+		window := time.Duration(0)
+		if conf.notify != nil {
+			window = conf.window
+		}
+		be, err := reactor.NewIdleBackend(ctx, conf.idle, window)
+		if err := add("idle", be, err); err != nil {
+			return nil, err
+		}
+	}
+	if conf.x11 {
+		be, err := reactor.NewX11Backend(ctx)
+		if err := add("x11", be, err); err != nil {
+			return nil, err
+		}
+	}
+	session := false
+	for _, v := range conf.confirm {
+		var (
+			be  reactor.Backend
+			err error
+		)
+		if v == "screensaver" {
+			be, err = reactor.NewScreenSaverBackend(ctx)
+		} else {
+			be, err = reactor.NewSessionLockBackend(ctx)
+			session = true
+		}
+		if err := add(v, be, err); err != nil {
+			return nil, err
+		}
+	}
+	if conf.relaunch && !session {
+		// for unlock events; relaunching works without
+		if be, err := reactor.NewSessionLockBackend(ctx); err != nil {
+			log.Println("relaunch: session:", err)
+		} else {
+			bes = append(bes, be)
+		}
+	}
+	for _, t := range conf.triggers {
+		be, err := reactor.NewTriggerBackend(ctx, t)
+		if err := add("trigger "+t.Rule, be, err); err != nil {
+			return nil, err
+		}
+	}
+	if conf.helper != nil {
+		be, err := reactor.NewExternalBackend(ctx, conf.helper)
+		if err := add("external", be, err); err != nil {
+			return nil, err
+		}
+	}
+	switch len(bes) {
+	case 0:
+		return nil, reactor.ErrNoBackend
+	case 1:
+		return bes[0], nil
+	}
+	return reactor.NewMuxBackend(bes...), nil
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lmsgprefix)
 	log.SetPrefix("ussssr: ")
 	parseFlags()
-	loop()
+	ctx, stop := signal.NotifyContext(context.Background(),
+		syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if conf.list {
+		listBackends(ctx)
+	}
+	be, err := openBackend(ctx)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	r := &reactor.Reactor{
+		Backend:       be,
+		Cmd:           conf.cmd,
+		Delay:         conf.delay,
+		Background:    conf.bg,
+		Notify:        conf.notify,
+		PassLock:      conf.pass,
+		ReadyFD:       conf.ready,
+		Confirm:       conf.confirm != nil || conf.check != nil,
+		Check:         conf.check,
+		ExitOnFailure: conf.failExit,
+		Failure:       conf.failure,
+		FailNotify:    conf.failNote,
+		Relaunch:      conf.relaunch,
+		UnlockStatus:  conf.unlocked,
+		Track:         conf.track,
+		TimeoutAction: conf.onTime,
+		Grace:         conf.grace,
+		Busy:          conf.busy,
+		MinInterval:   conf.interval,
+	}
+	if d, ok := be.(*reactor.DebugBackend); ok {
+		r.Start = d.Start
+	} else if len(conf.cmd) == 1 {
+		r.Start = reactor.LookupAction(conf.cmd[0])
+	}
+	for _, v := range conf.fallback {
+		l := reactor.Locker{Cmd: v}
+		if len(v) == 1 {
+			l.Start = reactor.LookupAction(v[0])
+		}
+		r.Fallback = append(r.Fallback, l)
+	}
+	err = r.Run(ctx)
+	be.Close()
+	if err == reactor.ErrFailed {
+		os.Exit(3) // logged by Run
+	} else if err != context.Canceled {
+		log.Fatalln(err)
+	}
 }
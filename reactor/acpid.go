@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	acpidSocket  = "/var/run/acpid.socket"
+	acpidSigName = "acpid.event" // name of synthesized signals
+)
+
+/*
+AcpidBackend is the backend for acpid, for systems without logind
+or UPower.  No D-Bus connection is needed; instead, events read
+from the acpid socket are passed to Handle as signals.
+
+Lid closing (button/lid ... close) is a lock event.  Sleep,
+suspend and power buttons (button/sleep, button/suspend,
+button/power) are sleep events.  acpid doesn't support inhibiting
+sleep or wakeup notifications; Release is a no-op.
+
+If the connection to acpid is lost, e.g., when it's restarted,
+AcpidBackend reconnects with exponential backoff.
+*/
+type AcpidBackend struct {
+	sc   chan *dbus.Signal
+	done chan struct{}
+	mu   sync.Mutex // protects conn
+	conn net.Conn
+}
+
+// NewAcpidBackend connects to the acpid socket.
+func NewAcpidBackend(ctx context.Context) (Backend, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", acpidSocket)
+	if err != nil {
+		return nil, err
+	}
+	be := &AcpidBackend{
+		sc:   make(chan *dbus.Signal, 4),
+		done: make(chan struct{}),
+		conn: conn,
+	}
+	go be.read(conn)
+	return be, nil
+}
+
+func (*AcpidBackend) Name() string                    { return "acpid" }
+func (*AcpidBackend) Filter() string                  { return "none" }
+func (be *AcpidBackend) Signals() <-chan *dbus.Signal { return be.sc }
+func (*AcpidBackend) Release() error                  { return nil }
+
+func (*AcpidBackend) MaxInhibit() (time.Duration, error) {
+	return -1, nil
+}
+
+// read reads events from conn, reconnecting when it's lost.
+func (be *AcpidBackend) read(conn net.Conn) {
+	defer close(be.sc)
+	for conn != nil {
+		s := bufio.NewScanner(conn)
+		for s.Scan() {
+			sig := &dbus.Signal{
+				Name: acpidSigName,
+				Body: []interface{}{s.Text()},
+			}
+			select {
+			case be.sc <- sig:
+			case <-be.done:
+				return
+			}
+		}
+		conn.Close()
+		select {
+		case <-be.done:
+			return
+		default:
+		}
+		err := s.Err()
+		if err == nil {
+			err = io.EOF
+		}
+		logln("acpid: connection lost:", err)
+		conn = be.redial()
+	}
+}
+
+// redial reconnects to acpid, returning nil when closed.
+func (be *AcpidBackend) redial() net.Conn {
+	for delay := minRetry; ; {
+		select {
+		case <-be.done:
+			return nil
+		case <-time.After(delay):
+		}
+		conn, err := net.Dial("unix", acpidSocket)
+		if err != nil {
+			debugln("acpid:", err)
+			if delay *= 2; delay > maxRetry {
+				delay = maxRetry
+			}
+			continue
+		}
+		be.mu.Lock()
+		defer be.mu.Unlock()
+		select {
+		case <-be.done:
+			conn.Close()
+			return nil
+		default:
+		}
+		debugln("acpid: reconnected")
+		be.conn = conn
+		return conn
+	}
+}
+
+func (be *AcpidBackend) Handle(sig *dbus.Signal) (Event, error) {
+	if sig.Name != acpidSigName || len(sig.Body) < 1 {
+		return None, ErrDBusSignal
+	}
+	line, _ := sig.Body[0].(string)
+	f := strings.Fields(line)
+	if len(f) == 0 {
+		return None, ErrDBusSignal
+	}
+	switch f[0] {
+	case "button/lid":
+		if len(f) > 2 && f[2] == "close" {
+			return Lock, nil
+		}
+	case "button/sleep", "button/suspend", "button/power":
+		return Sleep, nil
+	}
+	return None, nil
+}
+
+// Close closes the connection to acpid.
+func (be *AcpidBackend) Close() error {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	close(be.done)
+	return be.conn.Close()
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+/*
+Action is a built-in command, usable as Reactor.Start.  It must
+return an error if the action cannot be started, otherwise send
+the result to stopped upon completion.
+
+Built-in actions need no extra process.  They connect in the
+background, so as not to hold up Run, and failure to connect is
+sent to stopped like the result:
+
+	logind:lock-session           lock the logind session
+	freedesktop-screensaver:lock  org.freedesktop.ScreenSaver.Lock
+	gnome-screensaver:lock        org.gnome.ScreenSaver.Lock
+	kde:lock                      lock via org.kde.screensaver
+	x11:activate                  activate the X screen saver
+*/
+type Action func(stopped chan<- error) error
+
+// actions lists built-in action names and constructors.
+var actions = []struct {
+	name string
+	new  func() Action
+}{
+	{"logind:lock-session", func() Action {
+		return (&dbusAction{
+			connect: dbus.ConnectSystemBus,
+			dest:    sdDest,
+			resolve: sessionPath,
+			method:  sdSession + ".Lock",
+		}).start
+	}},
+	{"freedesktop-screensaver:lock", func() Action {
+		return (&dbusAction{
+			connect: dbus.ConnectSessionBus,
+			dest:    "org.freedesktop.ScreenSaver",
+			path:    "/org/freedesktop/ScreenSaver",
+			method:  "org.freedesktop.ScreenSaver.Lock",
+		}).start
+	}},
+	{"gnome-screensaver:lock", func() Action {
+		return (&dbusAction{
+			connect: dbus.ConnectSessionBus,
+			dest:    "org.gnome.ScreenSaver",
+			path:    "/org/gnome/ScreenSaver",
+			method:  "org.gnome.ScreenSaver.Lock",
+		}).start
+	}},
+	{"kde:lock", func() Action {
+		return (&dbusAction{
+			connect: dbus.ConnectSessionBus,
+			dest:    "org.kde.screensaver",
+			path:    "/ScreenSaver",
+			method:  "org.freedesktop.ScreenSaver.Lock",
+		}).start
+	}},
+	{"x11:activate", func() Action { return X11Activate }},
+}
+
+// Actions returns the names of built-in actions.
+func Actions() []string {
+	names := make([]string, len(actions))
+	for i, v := range actions {
+		names[i] = v.name
+	}
+	return names
+}
+
+// LookupAction returns the named built-in action, or nil if there
+// is none.  Names are case insensitive.
+func LookupAction(name string) Action {
+	for _, v := range actions {
+		if strings.EqualFold(name, v.name) {
+			return v.new()
+		}
+	}
+	return nil
+}
+
+// dbusAction is an action calling a D-Bus method without arguments.
+// The connection is kept open between calls and reopened if lost.
+type dbusAction struct {
+	mu      sync.Mutex // serializes calls
+	connect func(...dbus.ConnOption) (*dbus.Conn, error)
+	dest    string
+	path    dbus.ObjectPath
+	method  string
+
+	// resolve, if non-nil, returns the object path
+	resolve func(context.Context, *dbus.Conn) (dbus.ObjectPath, error)
+
+	conn *dbus.Conn
+}
+
+// start calls the method in the background.
+func (a *dbusAction) start(stopped chan<- error) error {
+	go func() { stopped <- a.call() }()
+	return nil
+}
+
+// call connects if needed and calls the method.
+func (a *dbusAction) call() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(),
+		defaultTimeout)
+	defer cancel()
+	if a.conn == nil || !a.conn.Connected() {
+		conn, err := a.connect()
+		if err != nil {
+			return err
+		}
+		if a.resolve != nil {
+			if a.path, err = a.resolve(ctx, conn); err != nil {
+				conn.Close()
+				return err
+			}
+		}
+		a.conn = conn
+	}
+	return a.conn.Object(a.dest, a.path).CallWithContext(ctx,
+		a.method, 0).Err
+}
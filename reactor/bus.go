@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"strings"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	busAddMatch    = "org.freedesktop.DBus.AddMatch"
+	busRemoveMatch = "org.freedesktop.DBus.RemoveMatch"
+)
+
+/*
+bus is a private D-Bus connection, by default to the system bus,
+with signal filters installed, embedded by D-Bus backends.  It
+implements the Filter and Signals methods of Backend.
+
+The signal channel is closed when the connection is closed or
+lost.
+*/
+type bus struct {
+	conn    *dbus.Conn
+	filters []string
+	sc      chan *dbus.Signal
+}
+
+// open connects to the system bus and installs filters.
+func (b *bus) open(ctx context.Context, filters ...string) error {
+	return b.dial(ctx, dbus.ConnectSystemBus, filters...)
+}
+
+// dial connects to a bus using connect and installs filters.
+func (b *bus) dial(ctx context.Context, connect func(...dbus.ConnOption) (*dbus.Conn, error), filters ...string) error {
+	conn, err := connect()
+	if err != nil {
+		return err
+	}
+	b.conn, b.sc = conn, make(chan *dbus.Signal, 4)
+	conn.Signal(b.sc)
+	for _, v := range filters {
+		if err = b.add(ctx, v); err != nil {
+			conn.Close()
+			b.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// add installs filter.
+func (b *bus) add(ctx context.Context, filter string) error {
+	err := b.conn.BusObject().CallWithContext(ctx, busAddMatch, 0, filter).Err
+	if err == nil {
+		b.filters = append(b.filters, filter)
+	}
+	return err
+}
+
+// close removes the filters and closes the connection.
+func (b *bus) close() error {
+	if b.conn == nil {
+		return nil
+	}
+	for _, v := range b.filters {
+		b.conn.BusObject().Call(busRemoveMatch, 0, v)
+	}
+	err := b.conn.Close()
+	b.conn = nil
+	return err
+}
+
+// remove removes filter.
+func (b *bus) remove(filter string) error {
+	for i, v := range b.filters {
+		if v == filter {
+			b.filters = append(b.filters[:i:i], b.filters[i+1:]...)
+			return b.conn.BusObject().Call(busRemoveMatch, 0, v).Err
+		}
+	}
+	return nil
+}
+
+func (b *bus) Filter() string               { return strings.Join(b.filters, "; ") }
+func (b *bus) Signals() <-chan *dbus.Signal { return b.sc }
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	ssIface         = "org.freedesktop.ScreenSaver"
+	ssActiveChanged = ssIface + ".ActiveChanged"
+	ssFilter        = "type='signal',interface='" + ssIface +
+		"',member='ActiveChanged'"
+	sdLockedHint = "LockedHint"
+)
+
+/*
+ScreenSaverBackend generates locked events when the screen saver
+reports being activated via the ActiveChanged signal of
+org.freedesktop.ScreenSaver on the session bus, and unlock events
+when it's deactivated.  It serves to confirm that the screen is
+locked.
+*/
+type ScreenSaverBackend struct {
+	bus
+}
+
+// NewScreenSaverBackend connects to the session bus.
+func NewScreenSaverBackend(ctx context.Context) (Backend, error) {
+	var be ScreenSaverBackend
+	if err := be.dial(ctx, dbus.ConnectSessionBus, ssFilter); err != nil {
+		return nil, err
+	}
+	return &be, nil
+}
+
+func (*ScreenSaverBackend) Name() string    { return "screensaver" }
+func (*ScreenSaverBackend) Release() error  { return nil }
+func (be *ScreenSaverBackend) Close() error { return be.close() }
+
+func (*ScreenSaverBackend) MaxInhibit() (time.Duration, error) {
+	return -1, nil
+}
+
+func (*ScreenSaverBackend) Handle(sig *dbus.Signal) (Event, error) {
+	if sig.Name != ssActiveChanged || len(sig.Body) < 1 {
+		return None, ErrDBusSignal
+	}
+	active, ok := sig.Body[0].(bool)
+	if !ok {
+		return None, ErrDBusSignal
+	} else if !active {
+		return Unlock, nil
+	}
+	return Locked, nil
+}
+
+/*
+SessionLockBackend generates locked and unlock events when the
+LockedHint property of the logind session changes.  The session
+is the one given by $XDG_SESSION_ID, or else the one of this
+process.  It serves to confirm that the screen is locked.
+*/
+type SessionLockBackend struct {
+	bus
+	path   dbus.ObjectPath // session object path
+	locked bool            // LockedHint
+}
+
+// NewSessionLockBackend connects to the system bus and watches the
+// logind session's locked hint.
+func NewSessionLockBackend(ctx context.Context) (Backend, error) {
+	var be SessionLockBackend
+	if err := be.open(ctx); err != nil {
+		return nil, err
+	}
+	path, err := sessionPath(ctx, be.conn)
+	if err == nil {
+		err = be.add(ctx, "type='signal',path='"+string(path)+
+			"',interface='"+propIface+"',member='PropertiesChanged',"+
+			"arg0='"+sdSession+"'")
+	}
+	var vari dbus.Variant
+	if err == nil {
+		vari, err = be.conn.Object(sdDest, path).
+			GetProperty(sdSession + "." + sdLockedHint)
+	}
+	if err != nil {
+		be.close()
+		return nil, err
+	}
+	be.path = path
+	be.locked, _ = vari.Value().(bool)
+	return &be, nil
+}
+
+func (*SessionLockBackend) Name() string    { return "session" }
+func (*SessionLockBackend) Release() error  { return nil }
+func (be *SessionLockBackend) Close() error { return be.close() }
+
+func (*SessionLockBackend) MaxInhibit() (time.Duration, error) {
+	return -1, nil
+}
+
+func (be *SessionLockBackend) Handle(sig *dbus.Signal) (Event, error) {
+	if sig.Path != be.path || sig.Name != propChanged ||
+		len(sig.Body) < 3 || sig.Body[0] != sdSession {
+		return None, ErrDBusSignal
+	}
+	changed, _ := sig.Body[1].(map[string]dbus.Variant)
+	v, found := changed[sdLockedHint]
+	if !found {
+		return None, nil
+	}
+	locked, ok := v.Value().(bool)
+	if !ok {
+		return None, ErrDBusSignal
+	} else if locked == be.locked {
+		return None, nil
+	}
+	be.locked = locked
+	debugln("session locked:", locked)
+	if !locked {
+		return Unlock, nil
+	}
+	return Locked, nil
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	ckDest    = "org.freedesktop.ConsoleKit"
+	ckPath    = "/org/freedesktop/ConsoleKit/Manager"
+	ckIface   = ckDest + ".Manager"
+	ckInhibit = ckIface + ".Inhibit"
+
+	// ConsoleKit2 doesn't export its maximum inhibit delay;
+	// assume a conservative one.
+	ckMaxInhibit = 3 * time.Second
+)
+
+/*
+ConsoleKitBackend is the backend for ConsoleKit2, which provides
+sleep inhibit locks and PrepareForSleep signals compatible with
+those of systemd-logind.
+*/
+type ConsoleKitBackend struct {
+	inhibitor
+}
+
+var ErrCKInhibit = errors.New("invalid response from " + ckInhibit)
+
+// NewConsoleKitBackend connects to the system bus and takes a
+// sleep inhibit lock from ConsoleKit2.
+func NewConsoleKitBackend(ctx context.Context) (Backend, error) {
+	be := ConsoleKitBackend{inhibitor{
+		name:   "consolekit",
+		iface:  ckIface,
+		errInh: ErrCKInhibit,
+	}}
+	if err := be.open(ctx, ckDest, ckPath); err != nil {
+		return nil, err
+	}
+	return &be, nil
+}
+
+func (*ConsoleKitBackend) MaxInhibit() (time.Duration, error) {
+	return ckMaxInhibit, nil
+}
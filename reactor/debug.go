@@ -14,64 +14,75 @@
  * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
  */
 
-package main
+package reactor
 
 import (
 	"errors"
-	"log"
-	"os"
+	"io"
 	"time"
 
 	dbus "github.com/godbus/dbus/v5"
 )
 
 /*
-DebugBackend is a debug backend receiving commands from stdin.
-When -debug flag is given, no dbus connection is opened;
-instead, newDebugBackend returns a *DebugBackend and replaces the
-run function with one that simulates execution.
+DebugBackend is a debug backend receiving commands from a reader.
+No dbus connection is needed; instead, the signals returned by
+its Signals method are simulated.  Its Start method simulates
+execution and should be used as Reactor.Start.
 
-DebugBackend reads commands from stdin, simulating events:
+DebugBackend reads commands, simulating events:
 
-    s  Sleep signal received
-    w  Wakeup signal received
-    e  Running command exits with status 0
-    k  Running command killed
+	s  Sleep signal received
+	w  Wakeup signal received
+	l  Lock signal received
+	e  Running command exits with status 0
+	k  Running command killed
 
-'e' and 'k' are no-ops if no command is running.
+'e' and 'k' are no-ops if no command is running.  When reading
+fails, the signal channel is closed.
 */
 type DebugBackend struct {
+	r         io.Reader
 	cmd       chan byte
 	sc        chan *dbus.Signal
 	stopped   chan<- error
 	start     chan chan<- error
+	done      chan struct{}
 	inhibited bool
 }
 
-func newDebugBackend() (Backend, chan *dbus.Signal) {
+func NewDebugBackend(r io.Reader) *DebugBackend {
+	debugln("using backend debug")
 	be := &DebugBackend{
+		r:     r,
 		cmd:   make(chan byte),
 		sc:    make(chan *dbus.Signal),
 		start: make(chan chan<- error),
+		done:  make(chan struct{}),
 	}
 	go be.read()
 	go be.loop()
 	be.inhibit()
-	run = be.run
-	return be, be.sc
+	return be
 }
 
 func (be *DebugBackend) read() {
+	defer close(be.cmd)
 	var buf [16]byte
 	for {
-		n, err := os.Stdin.Read(buf[:])
+		n, err := be.r.Read(buf[:])
 		if err != nil {
-			log.Fatalln("read failed:", err)
+			logln("read failed:", err)
+			return
 		}
 		for _, v := range buf[:n] {
 			switch v {
-			case 's', 'w', 'e', 'k':
-				be.cmd <- v
+			case 's', 'w', 'l', 'e', 'k':
+				select {
+				case be.cmd <- v:
+				case <-be.done:
+					return
+				}
 			}
 		}
 	}
@@ -80,18 +91,36 @@ func (be *DebugBackend) read() {
 var (
 	debugSleepSignal  = dbus.Signal{Name: "sleep"}
 	debugWakeupSignal = dbus.Signal{Name: "wakeup"}
+	debugLockSignal   = dbus.Signal{Name: "lock"}
 	ErrDebugKilled    = errors.New("killed")
 )
 
+func (be *DebugBackend) send(sig *dbus.Signal) {
+	select {
+	case be.sc <- sig:
+	case <-be.done:
+	}
+}
+
 func (be *DebugBackend) loop() {
 	for {
 		select {
-		case b := <-be.cmd:
+		case <-be.done:
+			return
+		case b, ok := <-be.cmd:
+			if !ok {
+				// keep simulating until closed
+				close(be.sc)
+				be.cmd = nil
+				break
+			}
 			switch b {
 			case 's':
-				be.sc <- &debugSleepSignal
+				be.send(&debugSleepSignal)
 			case 'w':
-				be.sc <- &debugWakeupSignal
+				be.send(&debugWakeupSignal)
+			case 'l':
+				be.send(&debugLockSignal)
 			case 'e':
 				if be.stopped != nil {
 					be.stopped <- nil
@@ -108,8 +137,9 @@ func (be *DebugBackend) loop() {
 	}
 }
 
-func (*DebugBackend) Name() string   { return "debug" }
-func (*DebugBackend) Filter() string { return "none" }
+func (*DebugBackend) Name() string                    { return "debug" }
+func (*DebugBackend) Filter() string                  { return "none" }
+func (be *DebugBackend) Signals() <-chan *dbus.Signal { return be.sc }
 
 func (be *DebugBackend) inhibit() {
 	if be.inhibited {
@@ -119,12 +149,15 @@ func (be *DebugBackend) inhibit() {
 	be.inhibited = true
 }
 
-func (be *DebugBackend) Handle(sig *dbus.Signal) (bool, error) {
-	sleep := sig.Name == "sleep"
-	if !sleep {
-		be.inhibit()
+func (be *DebugBackend) Handle(sig *dbus.Signal) (Event, error) {
+	switch sig.Name {
+	case "sleep":
+		return Sleep, nil
+	case "lock":
+		return Lock, nil
 	}
-	return sleep, nil
+	be.inhibit()
+	return Wakeup, nil
 }
 
 func (be *DebugBackend) Release() error {
@@ -132,11 +165,17 @@ func (be *DebugBackend) Release() error {
 	return nil
 }
 
-func (be *DebugBackend) run(stopped chan<- error) error {
+// Start simulates starting a command.
+func (be *DebugBackend) Start(stopped chan<- error) error {
 	be.start <- stopped
 	return nil
 }
 
-func (DebugBackend) MaxInhibit() (time.Duration, error) {
+func (*DebugBackend) MaxInhibit() (time.Duration, error) {
 	return -1, nil
 }
+
+func (be *DebugBackend) Close() error {
+	close(be.done)
+	return nil
+}
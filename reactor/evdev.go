@@ -0,0 +1,277 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	evSysfs     = "/sys/class/input"
+	evDev       = "/dev/input"
+	evSigName   = "evdev.event"   // name of synthesized signals
+	evRescan    = 5 * time.Second // interval between device scans
+	evKey       = 1               // EV_KEY
+	evSw        = 5               // EV_SW
+	swLid       = 0               // SW_LID
+	keySleep    = 142             // KEY_SLEEP
+	keySuspend  = 205             // KEY_SUSPEND
+	evPressed   = 1               // key pressed, switch on
+	evCapKey    = "key"           // sysfs capability files
+	evCapSwitch = "sw"
+)
+
+var ErrNoEvdev = errors.New("no input device with lid switch or sleep key")
+
+// inputEvent is struct input_event from <linux/input.h>.
+type inputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+/*
+EvdevBackend is the backend reading input events directly from
+Linux input devices, for systems without any power daemon.  No
+D-Bus connection is needed; instead, input events are passed to
+Handle as signals.
+
+Devices with a lid switch (SW_LID) or a sleep key (KEY_SLEEP or
+KEY_SUSPEND) are found by their capability bits in sysfs.  The
+devices are rescanned every five seconds, and new ones are added.
+Lid closing is a lock event, sleep key press is a sleep event.
+Sleep can't be inhibited; Release is a no-op.
+
+An EvdevBackend created by NewEvdevReplayBackend reads recorded
+input_event streams from files instead, and closes the signal
+channel when all of them are read.
+*/
+type EvdevBackend struct {
+	sc    chan *dbus.Signal
+	done  chan struct{}
+	wg    sync.WaitGroup // readers
+	mu    sync.Mutex     // protects files
+	files map[string]*os.File
+}
+
+func newEvdevBackend() *EvdevBackend {
+	return &EvdevBackend{
+		sc:    make(chan *dbus.Signal, 4),
+		done:  make(chan struct{}),
+		files: make(map[string]*os.File),
+	}
+}
+
+// NewEvdevBackend opens the input devices with a lid switch or
+// a sleep key.  If none is found, ErrNoEvdev is returned.
+func NewEvdevBackend(ctx context.Context) (Backend, error) {
+	be := newEvdevBackend()
+	if err := be.scan(); err != nil {
+		return nil, err
+	} else if len(be.files) == 0 {
+		return nil, ErrNoEvdev
+	}
+	go be.rescan()
+	return be, nil
+}
+
+// NewEvdevReplayBackend opens files containing recorded
+// input_event streams.
+func NewEvdevReplayBackend(files []string) (Backend, error) {
+	be := newEvdevBackend()
+	for _, name := range files {
+		if err := be.add(name); err != nil {
+			be.Close()
+			return nil, err
+		}
+	}
+	go func() {
+		be.wg.Wait()
+		close(be.sc)
+	}()
+	return be, nil
+}
+
+func (*EvdevBackend) Name() string                    { return "evdev" }
+func (*EvdevBackend) Filter() string                  { return "none" }
+func (be *EvdevBackend) Signals() <-chan *dbus.Signal { return be.sc }
+func (*EvdevBackend) Release() error                  { return nil }
+
+func (*EvdevBackend) MaxInhibit() (time.Duration, error) {
+	return -1, nil
+}
+
+// hasCap reports whether bit is set in the sysfs capability
+// bitmap s, which consists of hexadecimal words of the size of
+// long, most significant first.
+func hasCap(s string, bit int) bool {
+	f := strings.Fields(s)
+	w := bit / strconv.IntSize
+	if w >= len(f) {
+		return false
+	}
+	v, err := strconv.ParseUint(f[len(f)-1-w], 16, 64)
+	return err == nil && v&(1<<(bit%strconv.IntSize)) != 0
+}
+
+// wanted reports whether the input device called name (e.g.,
+// "event3") has a lid switch or a sleep key.
+func wanted(name string) bool {
+	caps := filepath.Join(evSysfs, name, "device", "capabilities")
+	if b, err := os.ReadFile(filepath.Join(caps, evCapSwitch)); err == nil &&
+		hasCap(string(b), swLid) {
+		return true
+	}
+	b, err := os.ReadFile(filepath.Join(caps, evCapKey))
+	return err == nil &&
+		(hasCap(string(b), keySleep) || hasCap(string(b), keySuspend))
+}
+
+// scan opens wanted input devices not opened yet.
+func (be *EvdevBackend) scan() error {
+	names, err := filepath.Glob(filepath.Join(evSysfs, "event*"))
+	if err != nil {
+		return err
+	}
+	for _, v := range names {
+		name := filepath.Base(v)
+		path := filepath.Join(evDev, name)
+		be.mu.Lock()
+		_, open := be.files[path]
+		be.mu.Unlock()
+		if open || !wanted(name) {
+			continue
+		}
+		if err := be.add(path); err != nil {
+			logln("evdev:", err)
+		}
+	}
+	return nil
+}
+
+// rescan scans for new devices periodically.
+func (be *EvdevBackend) rescan() {
+	t := time.NewTicker(evRescan)
+	defer t.Stop()
+	for {
+		select {
+		case <-be.done:
+			return
+		case <-t.C:
+			if err := be.scan(); err != nil {
+				logln("evdev:", err)
+			}
+		}
+	}
+}
+
+// add opens path and starts reading it.
+func (be *EvdevBackend) add(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	select {
+	case <-be.done:
+		f.Close()
+		return nil
+	default:
+	}
+	debugln("evdev: reading", path)
+	be.files[path] = f
+	be.wg.Add(1)
+	go be.read(path, f)
+	return nil
+}
+
+// read reads input events from f.  When reading fails, e.g.,
+// because the device is removed, f is closed and forgotten.
+func (be *EvdevBackend) read(path string, f *os.File) {
+	defer be.wg.Done()
+	r := bufio.NewReader(f)
+	for {
+		var ev inputEvent
+		err := binary.Read(r, binary.NativeEndian, &ev)
+		if err != nil {
+			if err != io.EOF {
+				debugln("evdev:", err)
+			}
+			break
+		} else if ev.Type != evKey && ev.Type != evSw {
+			continue
+		}
+		sig := &dbus.Signal{
+			Path: dbus.ObjectPath("/" + filepath.Base(path)),
+			Name: evSigName,
+			Body: []interface{}{ev.Type, ev.Code, ev.Value},
+		}
+		select {
+		case be.sc <- sig:
+		case <-be.done:
+			return
+		}
+	}
+	be.mu.Lock()
+	delete(be.files, path)
+	be.mu.Unlock()
+	f.Close()
+}
+
+func (be *EvdevBackend) Handle(sig *dbus.Signal) (Event, error) {
+	if sig.Name != evSigName || len(sig.Body) < 3 {
+		return None, ErrDBusSignal
+	}
+	typ, _ := sig.Body[0].(uint16)
+	code, _ := sig.Body[1].(uint16)
+	value, _ := sig.Body[2].(int32)
+	switch {
+	case value != evPressed:
+	case typ == evSw && code == swLid:
+		return Lock, nil
+	case typ == evKey && (code == keySleep || code == keySuspend):
+		return Sleep, nil
+	}
+	return None, nil
+}
+
+// Close closes the input devices.
+func (be *EvdevBackend) Close() error {
+	be.mu.Lock()
+	close(be.done)
+	for _, f := range be.files {
+		f.Close()
+	}
+	be.mu.Unlock()
+	be.wg.Wait()
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+func TestHasCap(t *testing.T) {
+	if strconv.IntSize != 64 {
+		t.Skip("capability bitmaps below are for 64-bit longs")
+	}
+	for _, v := range []struct {
+		s    string
+		bit  int
+		want bool
+	}{
+		{"1\n", swLid, true},
+		{"0\n", swLid, false},
+		{"", swLid, false},
+		{"4000 0 0\n", keySleep, true},
+		{"4000 0 0\n", keySuspend, false},
+		{"2000 0 0 0\n", keySuspend, true},
+		{"2000 0 0 0\n", keySleep, false},
+		{"0 0\n", keySleep, false}, // too short
+		{"x 0 0\n", keySleep, false},
+		{"1002000 3803078f800d001 feffffdfffefffff fffffffffffffffe\n",
+			keySuspend, true},
+	} {
+		if got := hasCap(v.s, v.bit); got != v.want {
+			t.Errorf("hasCap(%q, %d) = %v, want %v",
+				v.s, v.bit, got, v.want)
+		}
+	}
+}
+
+func TestEvdevReplay(t *testing.T) {
+	const evSyn = 0
+	evs := []struct {
+		ev   inputEvent
+		want Event
+	}{
+		{inputEvent{Type: evSw, Code: swLid, Value: evPressed}, Lock},
+		{inputEvent{Type: evSyn}, -1}, // not passed on
+		{inputEvent{Type: evSw, Code: swLid, Value: 0}, None},
+		{inputEvent{Type: evKey, Code: keySleep, Value: evPressed}, Sleep},
+		{inputEvent{Type: evKey, Code: keySleep, Value: 0}, None},
+		{inputEvent{Type: evKey, Code: keySuspend, Value: 2}, None},
+		{inputEvent{Type: evKey, Code: keySuspend, Value: evPressed}, Sleep},
+		{inputEvent{Type: evKey, Code: 30, Value: evPressed}, None},
+	}
+	name := filepath.Join(t.TempDir(), "event0")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []Event
+	for _, v := range evs {
+		if err := binary.Write(f, binary.NativeEndian, &v.ev); err != nil {
+			t.Fatal(err)
+		}
+		if v.want >= 0 {
+			want = append(want, v.want)
+		}
+	}
+	f.Close()
+
+	be, err := NewEvdevReplayBackend([]string{name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer be.Close()
+	var got []Event
+	for sig := range be.Signals() {
+		ev, err := be.Handle(sig)
+		if err != nil {
+			t.Fatalf("Handle(%v): %v", sig, err)
+		}
+		got = append(got, ev)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got events %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("event %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+	if _, err := be.Handle(&dbus.Signal{Name: "foo"}); err != ErrDBusSignal {
+		t.Errorf("Handle(foreign signal) = %v, want ErrDBusSignal", err)
+	}
+}
+
+func TestEvdevReplayMissing(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "missing")
+	if _, err := NewEvdevReplayBackend([]string{name}); err == nil {
+		t.Error("NewEvdevReplayBackend succeeded on a missing file")
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const extSigName = "external.event" // name of synthesized signals
+
+// extEvent is an event read from the helper.
+type extEvent struct {
+	Event string `json:"event"`
+}
+
+// extAck is an acknowledgement written to the helper.
+type extAck struct {
+	Ack   string `json:"ack"`
+	Error string `json:"error,omitempty"`
+}
+
+/*
+ExternalBackend receives events from a helper program, for event
+sources outside of D-Bus.  No D-Bus connection is needed.
+
+The helper writes events to its standard output as JSON objects,
+one per line, such as
+
+	{"event":"sleep"}
+
+where the event is "sleep", "wakeup", "lock" or "unlock".  The
+backend writes acknowledgements to the helper's standard input in
+the same format:
+
+	{"ack":"released"}
+	{"ack":"command finished","error":"exit status 1"}
+
+"released" is written by Release, after which the helper may
+release its own sleep inhibit mechanism.  "command finished" is
+written when the command finishes, with the error, if any.
+
+If the helper exits, it is restarted with exponential backoff.
+*/
+type ExternalBackend struct {
+	args []string
+	sc   chan *dbus.Signal
+	done chan struct{}
+	exit chan struct{} // closed when supervise returns
+	mu   sync.Mutex    // protects cmd, in and enc
+	cmd  *exec.Cmd
+	in   io.Closer // helper's standard input
+	enc  *json.Encoder
+}
+
+// NewExternalBackend starts the helper program args[0] with
+// arguments args[1:].
+func NewExternalBackend(ctx context.Context, args []string) (Backend, error) {
+	be := &ExternalBackend{
+		args: args,
+		sc:   make(chan *dbus.Signal, 4),
+		done: make(chan struct{}),
+		exit: make(chan struct{}),
+	}
+	out, err := be.start()
+	if err != nil {
+		return nil, err
+	}
+	go be.supervise(out)
+	return be, nil
+}
+
+func (*ExternalBackend) Name() string                    { return "external" }
+func (*ExternalBackend) Filter() string                  { return "none" }
+func (be *ExternalBackend) Signals() <-chan *dbus.Signal { return be.sc }
+
+func (*ExternalBackend) MaxInhibit() (time.Duration, error) {
+	return -1, nil
+}
+
+// start starts the helper, returning its standard output.
+func (be *ExternalBackend) start() (io.Reader, error) {
+	cmd := exec.Command(be.args[0], be.args[1:]...)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := startCmd(cmd); err != nil {
+		return nil, err
+	}
+	be.mu.Lock()
+	be.cmd, be.in, be.enc = cmd, in, json.NewEncoder(in)
+	be.mu.Unlock()
+	return out, nil
+}
+
+// supervise reads events from the helper and restarts it when it
+// exits.
+func (be *ExternalBackend) supervise(out io.Reader) {
+	defer close(be.exit)
+	defer close(be.sc)
+	delay := minRetry
+	for {
+		start := time.Now()
+		be.read(out)
+		err := waitCmd(be.cmd)
+		select {
+		case <-be.done:
+			return
+		default:
+		}
+		logln("external: helper exited:", err)
+		if time.Since(start) > maxRetry {
+			delay = minRetry
+		}
+		for {
+			select {
+			case <-be.done:
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > maxRetry {
+				delay = maxRetry
+			}
+			if out, err = be.start(); err == nil {
+				break
+			}
+			logln("external:", err)
+		}
+		debugln("external: helper restarted")
+	}
+}
+
+// read reads events from out until it's closed.
+func (be *ExternalBackend) read(out io.Reader) {
+	s := bufio.NewScanner(out)
+	for s.Scan() {
+		var ev extEvent
+		if err := json.Unmarshal(s.Bytes(), &ev); err != nil {
+			logln("external:", err)
+			continue
+		}
+		sig := &dbus.Signal{
+			Name: extSigName,
+			Body: []interface{}{ev.Event},
+		}
+		select {
+		case be.sc <- sig:
+		case <-be.done:
+			return
+		}
+	}
+}
+
+// ack writes an acknowledgement to the helper.
+func (be *ExternalBackend) ack(a extAck) error {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	return be.enc.Encode(a)
+}
+
+func (be *ExternalBackend) Handle(sig *dbus.Signal) (Event, error) {
+	if sig.Name != extSigName || len(sig.Body) < 1 {
+		return None, ErrDBusSignal
+	}
+	s, _ := sig.Body[0].(string)
+	ev, err := ParseEvent(s)
+	if err != nil {
+		return None, ErrDBusSignal
+	}
+	return ev, nil
+}
+
+func (be *ExternalBackend) Release() error {
+	return be.ack(extAck{Ack: "released"})
+}
+
+func (be *ExternalBackend) CommandFinished(err error) {
+	a := extAck{Ack: "command finished"}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	if err := be.ack(a); err != nil {
+		logln("external:", err)
+	}
+}
+
+// Close closes the helper's standard input, terminates it and
+// waits for it to exit.
+func (be *ExternalBackend) Close() error {
+	close(be.done)
+	be.mu.Lock()
+	be.in.Close()
+	be.cmd.Process.Signal(syscall.SIGTERM)
+	be.mu.Unlock()
+	<-be.exit
+	return nil
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	sdGetSession   = sdIface + ".GetSession"
+	sdSessionByPID = sdIface + ".GetSessionByPID"
+	sdSession      = sdDest + ".Session"
+	sdIdleHint     = "IdleHint"
+	sdIdleSince    = "IdleSinceHint"
+	idleSigName    = "idle.timeout" // names of synthesized signals
+	idleSigNotify  = "idle.notify"
+	idleSigActive  = "idle.active"
+)
+
+var ErrSDSession = errors.New("invalid response from " + sdGetSession)
+
+/*
+IdleBackend generates lock events when the logind session has
+been idle for a given period, as reported by the session's
+IdleHint and IdleSinceHint properties.  The session is the one
+given by $XDG_SESSION_ID, or else the one of this process.
+
+If the notification window is positive, an idle event is
+generated that long before the lock event, and an active event if
+the session stops being idle in between.
+*/
+type IdleBackend struct {
+	bus
+	session dbus.BusObject    // logind session object
+	period  time.Duration     // idle period before locking
+	window  time.Duration     // notification window before locking
+	out     chan *dbus.Signal // signals returned by Signals
+	done    chan struct{}
+	exit    chan struct{} // closed when watch returns
+}
+
+// sessionPath returns the path of the logind session object given
+// by $XDG_SESSION_ID, or else of the session of this process.
+func sessionPath(ctx context.Context, conn *dbus.Conn) (dbus.ObjectPath, error) {
+	var (
+		path dbus.ObjectPath
+		call *dbus.Call
+		obj  = conn.Object(sdDest, sdPath)
+	)
+	if id := os.Getenv("XDG_SESSION_ID"); id != "" {
+		call = obj.CallWithContext(ctx, sdGetSession, 0, id)
+	} else {
+		call = obj.CallWithContext(ctx, sdSessionByPID, 0,
+			uint32(os.Getpid()))
+	}
+	if err := call.Store(&path); err != nil {
+		return "", err
+	} else if !path.IsValid() {
+		return "", ErrSDSession
+	}
+	return path, nil
+}
+
+// NewIdleBackend connects to the system bus and watches the
+// logind session's idle hint.  window is the notification window.
+func NewIdleBackend(ctx context.Context, period, window time.Duration) (Backend, error) {
+	be := IdleBackend{
+		period: period,
+		window: window,
+		out:    make(chan *dbus.Signal, 4),
+		done:   make(chan struct{}),
+		exit:   make(chan struct{}),
+	}
+	if err := be.open(ctx); err != nil {
+		return nil, err
+	}
+	path, err := sessionPath(ctx, be.conn)
+	if err == nil {
+		be.session = be.conn.Object(sdDest, path)
+		err = be.add(ctx, "type='signal',path='"+string(path)+
+			"',interface='"+propIface+"',member='PropertiesChanged',"+
+			"arg0='"+sdSession+"'")
+	}
+	if err != nil {
+		be.close()
+		return nil, err
+	}
+	debugln("idle: watching session", path)
+	go be.watch()
+	return &be, nil
+}
+
+func (*IdleBackend) Name() string                    { return "idle" }
+func (be *IdleBackend) Signals() <-chan *dbus.Signal { return be.out }
+func (*IdleBackend) Release() error                  { return nil }
+
+func (*IdleBackend) MaxInhibit() (time.Duration, error) {
+	return -1, nil
+}
+
+// idleSince returns the time the session became idle, or the
+// zero Time if it's not idle.
+func (be *IdleBackend) idleSince() (time.Time, error) {
+	vari, err := be.session.GetProperty(sdSession + "." + sdIdleHint)
+	if err != nil {
+		return time.Time{}, err
+	} else if idle, _ := vari.Value().(bool); !idle {
+		return time.Time{}, nil
+	}
+	vari, err = be.session.GetProperty(sdSession + "." + sdIdleSince)
+	if err != nil {
+		return time.Time{}, err
+	}
+	usec, _ := vari.Value().(uint64)
+	if usec == 0 {
+		return time.Now(), nil
+	}
+	return time.UnixMicro(int64(usec)), nil
+}
+
+// send sends a synthesized signal.
+func (be *IdleBackend) send(name string) {
+	select {
+	case be.out <- &dbus.Signal{Path: be.session.Path(), Name: name}:
+	case <-be.done:
+	}
+}
+
+// watch tracks the idle hint, generating signals when the
+// notification window starts and after the session has been idle
+// for the period.
+func (be *IdleBackend) watch() {
+	defer close(be.exit)
+	defer close(be.out)
+	var (
+		last   time.Time // idle since, for each idle period once
+		warned bool      // idle signal sent, lock pending
+		timer  = time.NewTimer(time.Hour)
+	)
+	timer.Stop()
+	// arm sets the timer for the next signal
+	arm := func() {
+		d := be.period - time.Since(last)
+		if !warned && be.window > 0 {
+			d -= be.window
+		}
+		timer.Reset(d)
+	}
+	update := func() {
+		since, err := be.idleSince()
+		if err != nil {
+			logln("idle:", err)
+			return
+		} else if since.Equal(last) {
+			return
+		}
+		last = since
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if warned {
+			warned = false
+			be.send(idleSigActive)
+		}
+		if !since.IsZero() {
+			debugln("idle since", since)
+			arm()
+		}
+	}
+	update()
+	for {
+		select {
+		case <-be.done:
+			return
+		case sig, ok := <-be.sc:
+			if !ok {
+				return
+			}
+			if sig.Name == propChanged && sig.Path == be.session.Path() {
+				update()
+			}
+		case <-timer.C:
+			if !warned && be.window > 0 {
+				warned = true
+				be.send(idleSigNotify)
+				arm()
+			} else {
+				warned = false
+				be.send(idleSigName)
+			}
+		}
+	}
+}
+
+func (be *IdleBackend) Handle(sig *dbus.Signal) (Event, error) {
+	switch sig.Name {
+	case idleSigName:
+		return Lock, nil
+	case idleSigNotify:
+		return Idle, nil
+	case idleSigActive:
+		return Active, nil
+	}
+	return None, ErrDBusSignal
+}
+
+// Close stops watching and closes the connection.
+func (be *IdleBackend) Close() error {
+	close(be.done)
+	<-be.exit
+	return be.close()
+}
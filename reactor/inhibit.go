@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2013, 2024, 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const prepareForSleep = "PrepareForSleep"
+
+// managerFilter returns the filter for PrepareForSleep signals
+// of the manager interface iface.
+func managerFilter(iface string) string {
+	return "type='signal',interface='" + iface + "',member=" +
+		prepareForSleep
+}
+
+/*
+inhibitor implements the sleep inhibit lock handling common to
+logind and ConsoleKit2, whose managers provide the Inhibit method
+returning a file descriptor and the PrepareForSleep signal.  It
+implements the Handle, Release and Close methods of Backend,
+LockPasser and Blocker.
+*/
+type inhibitor struct {
+	bus
+	name   string         // backend name
+	obj    dbus.BusObject // manager object
+	iface  string         // manager interface
+	errInh error          // invalid response from Inhibit
+	fd     int            // inhibit lock fd or -1
+	block  int            // block inhibit lock fd or -1
+}
+
+// open connects to the system bus, installs the filter and takes
+// the inhibit lock.
+func (be *inhibitor) open(ctx context.Context, dest string, path dbus.ObjectPath) error {
+	be.fd, be.block = -1, -1
+	if err := be.bus.open(ctx, managerFilter(be.iface)); err != nil {
+		return err
+	}
+	be.obj = be.conn.Object(dest, path)
+	if err := be.inhibit(ctx); err != nil {
+		be.close()
+		return err
+	}
+	return nil
+}
+
+func (be *inhibitor) Name() string { return be.name }
+
+func (be *inhibitor) inhibit(ctx context.Context) error {
+	if be.fd != -1 {
+		logln(be.name + ".inhibit called before releasing old lock")
+		// The fd is not trusted, better close it
+		if err := be.Release(); err != nil {
+			logln(err)
+		}
+		// Try to inhibit anyway
+	}
+	fd, err := be.take(ctx, "delay", "Lock screen")
+	if err == nil {
+		be.fd = fd
+	}
+	return err
+}
+
+// take takes an inhibit lock in mode, returning its fd.
+func (be *inhibitor) take(ctx context.Context, mode, why string) (int, error) {
+	r := be.obj.CallWithContext(ctx, be.iface+".Inhibit", 0,
+		"sleep", "ussssr", why, mode)
+	if r.Err != nil {
+		return -1, r.Err
+	} else if len(r.Body) < 1 {
+		return -1, be.errInh
+	}
+	fd, ok := r.Body[0].(dbus.UnixFD)
+	if !ok || fd < 0 {
+		return -1, be.errInh
+	}
+	syscall.CloseOnExec(int(fd))
+	return int(fd), nil
+}
+
+// Block takes a block inhibit lock, unless already held.
+func (be *inhibitor) Block() error {
+	if be.block != -1 {
+		return nil
+	}
+	fd, err := be.take(context.Background(), "block",
+		"Screen not locked")
+	if err == nil {
+		be.block = fd
+	}
+	return err
+}
+
+// Unblock releases the block inhibit lock, if held.
+func (be *inhibitor) Unblock() error {
+	if be.block == -1 {
+		return nil
+	}
+	err := syscall.Close(be.block)
+	be.block = -1
+	return err
+}
+
+func (be *inhibitor) Handle(sig *dbus.Signal) (Event, error) {
+	if sig.Path != be.obj.Path() ||
+		sig.Name != be.iface+"."+prepareForSleep || len(sig.Body) < 1 {
+		return None, ErrDBusSignal
+	}
+	sleep, ok := sig.Body[0].(bool)
+	if !ok {
+		return None, ErrDBusSignal
+	} else if sleep {
+		return Sleep, nil
+	} else if err := be.inhibit(context.Background()); err != nil {
+		return None, err
+	}
+	return Wakeup, nil
+}
+
+func (be *inhibitor) Release() error {
+	var err error
+	if be.fd != -1 {
+		err = syscall.Close(be.fd)
+		be.fd = -1
+	} else {
+		logln(be.name + ".Release called but no inhibit lock is held")
+	}
+	return err
+}
+
+// LockFile returns a duplicate of the inhibit lock fd, or nil if
+// no lock is held.
+func (be *inhibitor) LockFile() (*os.File, error) {
+	if be.fd == -1 {
+		return nil, nil
+	}
+	syscall.ForkLock.RLock()
+	fd, err := syscall.Dup(be.fd)
+	if err == nil {
+		syscall.CloseOnExec(fd)
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "sleep-lock"), nil
+}
+
+// Close releases the inhibit locks, if held, and closes the
+// connection.
+func (be *inhibitor) Close() error {
+	if be.fd != -1 {
+		be.Release()
+	}
+	be.Unblock()
+	return be.close()
+}
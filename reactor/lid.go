@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	propIface    = "org.freedesktop.DBus.Properties"
+	propChanged  = propIface + ".PropertiesChanged"
+	upLidClosed  = "LidIsClosed"
+	upLidPresent = upIface + ".LidIsPresent"
+	upLidFilter  = "type='signal',path='" + upPath + "',interface='" +
+		propIface + "',member='PropertiesChanged',arg0='" + upIface + "'"
+	sdDocked    = sdIface + ".Docked"
+	lidDebounce = 2 * time.Second // minimum interval between lid locks
+)
+
+var ErrNoLid = errors.New("no lid present")
+
+/*
+LidBackend generates lock events when the lid is closed, as
+reported by the LidIsClosed property of UPower, regardless of
+whether the system goes to sleep, e.g., when logind ignores the
+lid because an external monitor is connected.  Lid closing less
+than two seconds after the previous lock event is ignored.  If
+the backend is created with docked set, lock events are only
+generated while logind reports the system as docked.
+*/
+type LidBackend struct {
+	bus
+	up     dbus.BusObject // UPower object
+	docked bool           // lock only when docked
+	closed bool           // lid is closed
+	last   time.Time      // last lock event
+}
+
+// NewLidBackend connects to the system bus and checks that UPower
+// reports a lid.
+func NewLidBackend(ctx context.Context, docked bool) (Backend, error) {
+	be := LidBackend{docked: docked}
+	if err := be.open(ctx, upLidFilter); err != nil {
+		return nil, err
+	}
+	be.up = be.conn.Object(upDest, upPath)
+	vari, err := be.up.GetProperty(upLidPresent)
+	if err == nil {
+		if present, _ := vari.Value().(bool); !present {
+			err = ErrNoLid
+		} else if vari, err = be.up.GetProperty(upIface + "." +
+			upLidClosed); err == nil {
+			be.closed, _ = vari.Value().(bool)
+		}
+	}
+	if err != nil {
+		be.close()
+		return nil, err
+	}
+	return &be, nil
+}
+
+func (*LidBackend) Name() string    { return "lid" }
+func (*LidBackend) Release() error  { return nil }
+func (be *LidBackend) Close() error { return be.close() }
+
+func (*LidBackend) MaxInhibit() (time.Duration, error) {
+	return -1, nil
+}
+
+// lidClosed returns the value of LidIsClosed from the body of a
+// PropertiesChanged signal, or queries it if it's invalidated.
+// If the property didn't change, ok is false.
+func (be *LidBackend) lidClosed(body []interface{}) (closed, ok bool, err error) {
+	changed, _ := body[1].(map[string]dbus.Variant)
+	if v, found := changed[upLidClosed]; found {
+		if closed, ok = v.Value().(bool); !ok {
+			err = ErrDBusSignal
+		}
+		return
+	}
+	inval, _ := body[2].([]string)
+	for _, v := range inval {
+		if v == upLidClosed {
+			vari, err := be.up.GetProperty(upIface + "." + upLidClosed)
+			if err != nil {
+				return false, false, err
+			}
+			closed, ok = vari.Value().(bool)
+			if !ok {
+				err = ErrDBusSignal
+			}
+			return closed, ok, err
+		}
+	}
+	return false, false, nil
+}
+
+// isDocked returns whether logind reports the system as docked.
+// If the query fails, true is returned.
+func (be *LidBackend) isDocked() bool {
+	vari, err := be.conn.Object(sdDest, sdPath).GetProperty(sdDocked)
+	if err != nil {
+		logln("lid:", err)
+		return true
+	}
+	docked, ok := vari.Value().(bool)
+	return docked || !ok
+}
+
+func (be *LidBackend) Handle(sig *dbus.Signal) (Event, error) {
+	if sig.Path != upPath || sig.Name != propChanged ||
+		len(sig.Body) < 3 || sig.Body[0] != upIface {
+		return None, ErrDBusSignal
+	}
+	closed, ok, err := be.lidClosed(sig.Body)
+	if !ok || closed == be.closed {
+		return None, err
+	}
+	be.closed = closed
+	debugln("lid closed:", closed)
+	if !closed || time.Since(be.last) < lidDebounce ||
+		be.docked && !be.isDocked() {
+		return None, nil
+	}
+	be.last = time.Now()
+	return Lock, nil
+}
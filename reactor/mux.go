@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+/*
+MuxBackend multiplexes several backends.
+
+The signals of all backends are merged into one channel, which is
+closed when any of the backends' channels is closed.  Each signal
+is passed to the Handle method of the backend it was received
+from.  Release is passed on to the backends that reported sleep
+since the last Release, Close to every backend, and
+CommandFinished to every Notifier.
+MaxInhibit returns the smallest maximum inhibit delay reported.
+*/
+type MuxBackend struct {
+	bes   []Backend
+	sc    chan *dbus.Signal
+	done  chan struct{}
+	stop  sync.Once // closes done
+	once  sync.Once // closes sc
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	owner map[*dbus.Signal]Backend // signals in transit
+	slept map[Backend]bool         // backends to release
+}
+
+// NewMuxBackend returns a MuxBackend multiplexing bes, taking
+// ownership of them.
+func NewMuxBackend(bes ...Backend) *MuxBackend {
+	be := &MuxBackend{
+		bes:   bes,
+		sc:    make(chan *dbus.Signal, 4),
+		done:  make(chan struct{}),
+		owner: make(map[*dbus.Signal]Backend),
+		slept: make(map[Backend]bool),
+	}
+	for _, v := range bes {
+		be.wg.Add(1)
+		go be.forward(v)
+	}
+	return be
+}
+
+// forward forwards signals from b, recording the owner.
+func (be *MuxBackend) forward(b Backend) {
+	defer be.wg.Done()
+	for {
+		select {
+		case <-be.done:
+			return
+		case sig, ok := <-b.Signals():
+			if !ok {
+				go be.shutdown()
+				return
+			}
+			be.mu.Lock()
+			be.owner[sig] = b
+			be.mu.Unlock()
+			select {
+			case be.sc <- sig:
+			case <-be.done:
+				return
+			}
+		}
+	}
+}
+
+// shutdown stops the forwarders and closes the signal channel
+// once none of them can send on it.
+func (be *MuxBackend) shutdown() {
+	be.stop.Do(func() { close(be.done) })
+	be.wg.Wait()
+	be.once.Do(func() { close(be.sc) })
+}
+
+func (be *MuxBackend) join(f func(Backend) string, sep string) string {
+	s := make([]string, len(be.bes))
+	for i, v := range be.bes {
+		s[i] = f(v)
+	}
+	return strings.Join(s, sep)
+}
+
+func (be *MuxBackend) Name() string   { return be.join(Backend.Name, "+") }
+func (be *MuxBackend) Filter() string { return be.join(Backend.Filter, "; ") }
+
+func (be *MuxBackend) Signals() <-chan *dbus.Signal { return be.sc }
+
+func (be *MuxBackend) Handle(sig *dbus.Signal) (Event, error) {
+	be.mu.Lock()
+	b := be.owner[sig]
+	delete(be.owner, sig)
+	be.mu.Unlock()
+	if b == nil {
+		return None, ErrDBusSignal
+	}
+	ev, err := b.Handle(sig)
+	if ev == Sleep {
+		be.mu.Lock()
+		be.slept[b] = true
+		be.mu.Unlock()
+	}
+	return ev, err
+}
+
+// Release releases the locks of the backends that reported sleep
+// since the last Release, returning the first error encountered.
+// Other errors are logged.  The locks of the other backends are
+// kept, lest sleep reported by one backend leave another's next
+// sleep uninhibited.
+func (be *MuxBackend) Release() error {
+	be.mu.Lock()
+	slept := be.slept
+	be.slept = make(map[Backend]bool)
+	be.mu.Unlock()
+	return be.each(func(b Backend) error {
+		if !slept[b] {
+			return nil
+		}
+		return b.Release()
+	}, ".Release:")
+}
+
+// Close closes all backends, returning the first error
+// encountered.  Other errors are logged.
+func (be *MuxBackend) Close() error {
+	be.shutdown()
+	return be.each(Backend.Close, ".Close:")
+}
+
+func (be *MuxBackend) each(f func(Backend) error, what string) error {
+	var first error
+	for _, v := range be.bes {
+		if err := f(v); err != nil {
+			if first == nil {
+				first = err
+			} else {
+				logln(v.Name()+what, err)
+			}
+		}
+	}
+	return first
+}
+
+// CommandFinished notifies the backends implementing Notifier.
+func (be *MuxBackend) CommandFinished(err error) {
+	for _, v := range be.bes {
+		if n, ok := v.(Notifier); ok {
+			n.CommandFinished(err)
+		}
+	}
+}
+
+// LockFile returns the lock file of the first backend implementing
+// LockPasser that holds a lock.
+func (be *MuxBackend) LockFile() (*os.File, error) {
+	for _, v := range be.bes {
+		if p, ok := v.(LockPasser); ok {
+			if f, err := p.LockFile(); f != nil || err != nil {
+				return f, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Block takes block inhibit locks of all backends implementing
+// Blocker, returning the first error encountered, or ErrNoBlock
+// if there are none.
+func (be *MuxBackend) Block() error {
+	n := 0
+	for _, v := range be.bes {
+		if _, ok := v.(Blocker); ok {
+			n++
+		}
+	}
+	if n == 0 {
+		return ErrNoBlock
+	}
+	return be.each(func(b Backend) error {
+		if v, ok := b.(Blocker); ok {
+			return v.Block()
+		}
+		return nil
+	}, ".Block:")
+}
+
+// Unblock releases the block inhibit locks of all backends
+// implementing Blocker, returning the first error encountered.
+func (be *MuxBackend) Unblock() error {
+	return be.each(func(b Backend) error {
+		if v, ok := b.(Blocker); ok {
+			return v.Unblock()
+		}
+		return nil
+	}, ".Unblock:")
+}
+
+// MaxInhibit returns the smallest maximum inhibit delay of all
+// backends supporting the query, or the first error encountered.
+func (be *MuxBackend) MaxInhibit() (time.Duration, error) {
+	min := time.Duration(-1)
+	for _, v := range be.bes {
+		max, err := v.MaxInhibit()
+		if err != nil {
+			return -1, err
+		} else if max >= 0 && (min < 0 || max < min) {
+			min = max
+		}
+	}
+	return min, nil
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"testing"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+// fakeBackend reports every signal as ev, counting releases.
+type fakeBackend struct {
+	name     string
+	ev       Event
+	sc       chan *dbus.Signal
+	released int
+}
+
+func newFake(name string, ev Event, n int) *fakeBackend {
+	return &fakeBackend{name: name, ev: ev, sc: make(chan *dbus.Signal, n)}
+}
+
+func (be *fakeBackend) Name() string                       { return be.name }
+func (be *fakeBackend) Filter() string                     { return "" }
+func (be *fakeBackend) Signals() <-chan *dbus.Signal       { return be.sc }
+func (be *fakeBackend) Handle(*dbus.Signal) (Event, error) { return be.ev, nil }
+func (be *fakeBackend) Release() error                     { be.released++; return nil }
+func (be *fakeBackend) MaxInhibit() (time.Duration, error) { return -1, nil }
+func (be *fakeBackend) Close() error                       { return nil }
+
+func TestMuxClose(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		a, b := newFake("a", Sleep, 64), newFake("b", Sleep, 64)
+		for j := 0; j < 64; j++ {
+			b.sc <- &dbus.Signal{}
+		}
+		be := NewMuxBackend(a, b)
+		close(a.sc)
+		for range be.Signals() {
+		}
+		be.Close()
+	}
+}
+
+func TestMuxRelease(t *testing.T) {
+	a, b := newFake("a", Sleep, 1), newFake("b", Lock, 1)
+	be := NewMuxBackend(a, b)
+	defer be.Close()
+	a.sc <- &dbus.Signal{}
+	b.sc <- &dbus.Signal{}
+	for i := 0; i < 2; i++ {
+		be.Handle(<-be.Signals())
+	}
+	be.Release()
+	if a.released != 1 || b.released != 0 {
+		t.Errorf("released a %d, b %d times, want 1, 0",
+			a.released, b.released)
+	}
+	be.Release()
+	if a.released != 1 {
+		t.Errorf("released a %d times after second Release, want 1",
+			a.released)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrNoBackend = errors.New("no backend available")
+
+type entry struct {
+	name string                                 // backend name
+	open func(context.Context) (Backend, error) // constructor
+}
+
+// backends lists backend names and constructors in the default
+// order of preference.
+var backends = []entry{
+	{"systemd", NewSystemdBackend},
+	{"consolekit", NewConsoleKitBackend},
+	{"upower", NewUPowerBackend},
+	{"portal", NewPortalBackend},
+	{"acpid", NewAcpidBackend},
+	{"evdev", NewEvdevBackend},
+}
+
+// Backends returns the names of known backends in the default
+// order of preference.
+func Backends() []string {
+	names := make([]string, len(backends))
+	for i, v := range backends {
+		names[i] = v.name
+	}
+	return names
+}
+
+// lookup returns the entries of named backends, or of all known
+// backends if names is empty.  Names are case insensitive.
+func lookup(names []string) ([]entry, error) {
+	if len(names) == 0 {
+		return backends, nil
+	}
+	es := make([]entry, len(names))
+outer:
+	for i, name := range names {
+		for _, v := range backends {
+			if strings.EqualFold(name, v.name) {
+				es[i] = v
+				continue outer
+			}
+		}
+		return nil, fmt.Errorf("unknown backend %q", name)
+	}
+	return es, nil
+}
+
+// Policy determines which of the selected backends Open uses.
+type Policy int
+
+const (
+	PolicyFirst Policy = iota // use the first available backend
+	PolicyAny                 // use all available backends
+	PolicyAll                 // use all backends, fail if any is unavailable
+)
+
+var policyNames = []string{"first", "any", "all"}
+
+func (p Policy) String() string {
+	if p >= 0 && int(p) < len(policyNames) {
+		return policyNames[p]
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// ParsePolicy returns the Policy called s.
+func ParsePolicy(s string) (Policy, error) {
+	for i, v := range policyNames {
+		if s == v {
+			return Policy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown policy %q", s)
+}
+
+/*
+Open opens the named backends, or all known backends if names is
+empty, in order, according to policy.  If more than one backend
+is opened, they are multiplexed by a MuxBackend.
+
+If no backend can be used, the returned error wraps ErrNoBackend
+and lists the reasons.  With PolicyAll, the error of the first
+unavailable backend is returned instead.
+*/
+func Open(ctx context.Context, names []string, policy Policy) (Backend, error) {
+	es, err := lookup(names)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		bes     []Backend
+		reasons []string
+	)
+	for _, e := range es {
+		be, err := e.open(ctx)
+		if err == nil {
+			bes = append(bes, be)
+			if policy == PolicyFirst {
+				break
+			}
+			continue
+		}
+		if ctx.Err() != nil || policy == PolicyAll {
+			for _, v := range bes {
+				v.Close()
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("%s: %w", e.name, err)
+		}
+		debugln(e.name+":", err)
+		reasons = append(reasons, e.name+": "+err.Error())
+	}
+	switch len(bes) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrNoBackend,
+			strings.Join(reasons, "; "))
+	case 1:
+		debugln("using backend", bes[0].Name(), "with filter",
+			bes[0].Filter())
+		return bes[0], nil
+	}
+	be := NewMuxBackend(bes...)
+	debugln("using backends", be.Name(), "with filters", be.Filter())
+	return be, nil
+}
+
+// Probe opens and closes the named backends, or all known
+// backends if names is empty, in order, returning for each the
+// reason it is unusable, or nil if it is usable.
+func Probe(ctx context.Context, names []string) ([]error, error) {
+	es, err := lookup(names)
+	if err != nil {
+		return nil, err
+	}
+	errs := make([]error, len(es))
+	for i, e := range es {
+		var be Backend
+		if be, errs[i] = e.open(ctx); errs[i] == nil {
+			errs[i] = be.Close()
+		}
+	}
+	return errs, ctx.Err()
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	ptDest          = "org.freedesktop.portal.Desktop"
+	ptPath          = "/org/freedesktop/portal/desktop"
+	ptIface         = "org.freedesktop.portal.Inhibit"
+	ptCreateMonitor = ptIface + ".CreateMonitor"
+	ptQueryEndResp  = ptIface + ".QueryEndResponse"
+	ptStateChanged  = ptIface + ".StateChanged"
+	ptResponse      = "org.freedesktop.portal.Request.Response"
+	ptSessionClose  = "org.freedesktop.portal.Session.Close"
+	ptFilter        = "type='signal',interface='" + ptIface +
+		"',member='StateChanged'"
+
+	// session states
+	ptRunning  = 1
+	ptQueryEnd = 2
+	ptEnding   = 3
+
+	// The portal doesn't export how long it waits for
+	// QueryEndResponse; assume a conservative delay.
+	ptMaxInhibit = time.Second
+)
+
+var ErrPTCreateMonitor = errors.New("invalid response from " +
+	ptCreateMonitor)
+
+/*
+PortalBackend is the backend for xdg-desktop-portal, usable from
+sandboxes (e.g., Flatpak) without access to the system bus.  It
+connects to the session bus and creates a session state monitor
+with the Inhibit portal.
+
+The session entering the query-end state (logout or shutdown) is
+a sleep event: the portal waits for QueryEndResponse, which is
+sent by Release.  The session returning from query-end to the
+running state is a wakeup event.  The screen saver becoming
+active is a lock event.  The ending state is not an event.
+*/
+type PortalBackend struct {
+	bus
+	obj      dbus.BusObject  // portal object
+	session  dbus.ObjectPath // monitor session handle
+	state    uint32          // session state
+	saver    bool            // screen saver active
+	queryEnd bool            // QueryEndResponse pending
+}
+
+// requestPath returns the path of the portal request object
+// created by the connection for token.
+func (be *PortalBackend) requestPath(token string) dbus.ObjectPath {
+	sender := strings.ReplaceAll(be.conn.Names()[0][1:], ".", "_")
+	return dbus.ObjectPath(ptPath + "/request/" + sender + "/" + token)
+}
+
+// createMonitor creates the session state monitor and waits for
+// the response.
+func (be *PortalBackend) createMonitor(ctx context.Context) error {
+	token := "ussssr" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	req := be.requestPath(token)
+	filter := "type='signal',interface='org.freedesktop.portal.Request'," +
+		"member='Response',path='" + string(req) + "'"
+	if err := be.add(ctx, filter); err != nil {
+		return err
+	}
+	defer be.remove(filter)
+	err := be.obj.CallWithContext(ctx, ptCreateMonitor, 0, "",
+		map[string]dbus.Variant{
+			"handle_token": dbus.MakeVariant(token),
+		}).Err
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sig, ok := <-be.sc:
+			if !ok {
+				return ErrClosed
+			} else if sig.Path != req || sig.Name != ptResponse {
+				continue
+			} else if len(sig.Body) < 2 {
+				return ErrPTCreateMonitor
+			}
+			if resp, _ := sig.Body[0].(uint32); resp != 0 {
+				return fmt.Errorf("%s: response %d",
+					ptCreateMonitor, resp)
+			}
+			res, _ := sig.Body[1].(map[string]dbus.Variant)
+			switch v := res["session_handle"].Value().(type) {
+			case string:
+				be.session = dbus.ObjectPath(v)
+			case dbus.ObjectPath:
+				be.session = v
+			}
+			if !be.session.IsValid() {
+				return ErrPTCreateMonitor
+			}
+			return nil
+		}
+	}
+}
+
+// NewPortalBackend connects to the session bus and creates a
+// session state monitor.
+func NewPortalBackend(ctx context.Context) (Backend, error) {
+	be := PortalBackend{state: ptRunning}
+	if err := be.dial(ctx, dbus.ConnectSessionBus); err != nil {
+		return nil, err
+	}
+	be.obj = be.conn.Object(ptDest, ptPath)
+	err := be.createMonitor(ctx)
+	if err == nil {
+		err = be.add(ctx, ptFilter)
+	}
+	if err != nil {
+		be.Close()
+		return nil, err
+	}
+	return &be, nil
+}
+
+func (*PortalBackend) Name() string { return "portal" }
+
+func (*PortalBackend) MaxInhibit() (time.Duration, error) {
+	return ptMaxInhibit, nil
+}
+
+func (be *PortalBackend) Handle(sig *dbus.Signal) (Event, error) {
+	if sig.Name != ptStateChanged || len(sig.Body) < 2 ||
+		sig.Body[0] != be.session {
+		return None, ErrDBusSignal
+	}
+	state, _ := sig.Body[1].(map[string]dbus.Variant)
+	saver, _ := state["screensaver-active"].Value().(bool)
+	s, _ := state["session-state"].Value().(uint32)
+	debugln("portal: session state", s, "screensaver", saver)
+	lock := saver && !be.saver
+	be.saver = saver
+	old := be.state
+	if s != 0 {
+		be.state = s
+	}
+	switch {
+	case be.state == ptQueryEnd && old != ptQueryEnd:
+		be.queryEnd = true
+		return Sleep, nil
+	case be.state == ptRunning && old == ptQueryEnd:
+		be.queryEnd = false
+		return Wakeup, nil
+	case lock:
+		return Lock, nil
+	}
+	return None, nil
+}
+
+// Release responds to query-end, if pending.
+func (be *PortalBackend) Release() error {
+	if !be.queryEnd {
+		return nil
+	}
+	be.queryEnd = false
+	return be.obj.Call(ptQueryEndResp, 0, be.session).Err
+}
+
+// Close responds to query-end, if pending, closes the monitor
+// session and the connection.
+func (be *PortalBackend) Close() error {
+	if be.conn == nil {
+		return nil
+	}
+	be.Release()
+	if be.session != "" {
+		be.conn.Object(ptDest, be.session).Call(ptSessionClose, 0)
+	}
+	return be.close()
+}
@@ -0,0 +1,1277 @@
+/*
+ * Copyright (c) 2013, 2022, 2024 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+/*
+Package reactor implements the UPower/Systemd Screen Saving Sleep
+Reactor: it runs a command, presumably one that locks the screen,
+when a sleep signal is received from a Backend, inhibiting sleep
+while the command runs.
+*/
+package reactor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	defaultTimeout = 5 * time.Second        // default max inhibit time
+	DefaultDelay   = 500 * time.Millisecond // default delay after command
+	DefaultGrace   = 2 * time.Second        // default delay before SIGKILL
+	minRetry       = time.Second            // reconnection delay...
+	maxRetry       = 30 * time.Second       // ...doubled up to this
+	checkInterval  = 100 * time.Millisecond // lock check command interval
+	crashWindow    = time.Minute            // locker crashes are counted...
+	maxCrashes     = 5                      // ...up to this many
+)
+
+// logging
+
+// LogLevel is the logging verbosity: 0 is silent, 1 logs errors,
+// 2 adds debug messages.
+var LogLevel = 1
+
+func loglnAt(ll int, v ...interface{}) {
+	if LogLevel >= ll {
+		log.Println(v...)
+	}
+}
+
+func logln(v ...interface{})   { loglnAt(1, v...) }
+func debugln(v ...interface{}) { loglnAt(2, v...) }
+
+var (
+	ErrDBusSignal = errors.New("invalid D-Bus signal")
+	ErrClosed     = errors.New("signal channel closed")
+	ErrReadyFD    = errors.New("readiness fd conflicts with sleep lock fd")
+	ErrFailed     = errors.New("all lockers failed")
+	ErrNoBlock    = errors.New("backend can't block sleep")
+	ErrCrashing   = errors.New("locker keeps crashing")
+	ErrNoCommand  = errors.New("locker has no command")
+)
+
+// Event is the kind of event a signal represents.
+type Event int
+
+const (
+	None   Event = iota // not an event
+	Sleep               // system is going to sleep
+	Wakeup              // system woke up
+	Lock                // screen should be locked, sleep not implied
+	Unlock              // screen was unlocked
+	Idle                // screen will be locked soon
+	Active              // user is active, lock cancelled
+	Locked              // screen is confirmed locked
+)
+
+var eventNames = []string{
+	"none", "sleep", "wakeup", "lock", "unlock", "idle", "active",
+	"locked",
+}
+
+func (ev Event) String() string {
+	if ev >= 0 && int(ev) < len(eventNames) {
+		return eventNames[ev]
+	}
+	return fmt.Sprintf("Event(%d)", int(ev))
+}
+
+/*
+Backend is the interface for backends.
+
+The Handle method handles a received signal, returning the event
+it represents and an error.  If the event is not None, the error
+must be nil.  For valid signals that don't represent events (such
+as a property change that doesn't matter), (None, nil) must be
+returned, for other signals (None, ErrDBusSignal).  If handling a
+signal fails, (None, err) must be returned.
+
+The Release method is called after the sleep preparation is
+complete, in order to release the sleep inhibit lock, if one is
+taken.
+
+The MaxInhibit method returns the current maximum inhibit delay.
+If the query is not supported, the returned Duration must be -1.
+
+The Signals method returns the channel of signals to be passed to
+Handle.  The channel is closed if the connection is lost.
+
+The Close method releases the sleep inhibit lock, if one is
+taken, removes the signal filter and closes the connection.
+
+Backends are created by constructors taking a context, which
+bounds the setup, and returning an error if the backend is not
+available.
+
+Backends that only generate lock-related events (lid, idle, X11
+and lock confirmation) don't handle sleep; their Release is a
+no-op, and they're meant to be multiplexed with a sleep backend
+by MuxBackend.
+*/
+type Backend interface {
+	Name() string                       // return backend name
+	Filter() string                     // return string for DBus.AddMatch
+	Signals() <-chan *dbus.Signal       // return signal channel
+	Handle(*dbus.Signal) (Event, error) // handle signal
+	Release() error                     // release sleep inhibit lock
+	MaxInhibit() (time.Duration, error) // return maximum inhibit delay
+	Close() error                       // release lock and disconnect
+}
+
+// Notifier is implemented by backends that need to know when the
+// command finishes.  CommandFinished is called with its wait
+// status.
+type Notifier interface {
+	CommandFinished(error)
+}
+
+// LockPasser is implemented by backends that can pass their sleep
+// inhibit lock to the command.  LockFile returns a duplicate of the
+// lock file descriptor, or nil if no lock is held.
+type LockPasser interface {
+	LockFile() (*os.File, error)
+}
+
+// Locker is a command or a built-in action locking the screen.
+type Locker struct {
+	Cmd   []string // command and arguments
+	Start Action   // if non-nil, called instead of executing Cmd
+}
+
+// Blocker is implemented by backends that can block sleep
+// altogether, as opposed to delaying it.
+type Blocker interface {
+	Block() error   // take block inhibit lock
+	Unblock() error // release block inhibit lock
+}
+
+// FailurePolicy determines what Run does when all lockers fail
+// while sleep is inhibited.
+type FailurePolicy int
+
+const (
+	FailRelease FailurePolicy = iota // release the inhibit lock
+	FailHold                         // hold it until deadline, retrying
+	FailBlock                        // hold, block sleep and notify
+)
+
+var failureNames = []string{"release", "hold", "block"}
+
+func (p FailurePolicy) String() string {
+	if p >= 0 && int(p) < len(failureNames) {
+		return failureNames[p]
+	}
+	return fmt.Sprintf("FailurePolicy(%d)", int(p))
+}
+
+// ParseFailurePolicy returns the FailurePolicy called s.
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	for i, v := range failureNames {
+		if s == v {
+			return FailurePolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown failure policy %q", s)
+}
+
+// BusyPolicy determines what Run does with sleep and lock events
+// received while the command is running.
+type BusyPolicy int
+
+const (
+	BusySwallow  BusyPolicy = iota // ignore the event
+	BusyCoalesce                   // run again once it exits
+	BusyRestart                    // terminate it and run again
+)
+
+var busyNames = []string{"swallow", "coalesce", "restart"}
+
+func (p BusyPolicy) String() string {
+	if p >= 0 && int(p) < len(busyNames) {
+		return busyNames[p]
+	}
+	return fmt.Sprintf("BusyPolicy(%d)", int(p))
+}
+
+// ParseBusyPolicy returns the BusyPolicy called s.
+func ParseBusyPolicy(s string) (BusyPolicy, error) {
+	for i, v := range busyNames {
+		if s == v {
+			return BusyPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown busy policy %q", s)
+}
+
+// TimeoutAction determines what Run does with a foreground command
+// still running when the release timer expires.
+type TimeoutAction int
+
+const (
+	TimeoutKeep TimeoutAction = iota // let it run
+	TimeoutTerm                      // send SIGTERM
+	TimeoutKill                      // SIGTERM, then SIGKILL after Grace
+)
+
+var timeoutNames = []string{"keep", "term", "kill"}
+
+func (a TimeoutAction) String() string {
+	if a >= 0 && int(a) < len(timeoutNames) {
+		return timeoutNames[a]
+	}
+	return fmt.Sprintf("TimeoutAction(%d)", int(a))
+}
+
+// ParseTimeoutAction returns the TimeoutAction called s.
+func ParseTimeoutAction(s string) (TimeoutAction, error) {
+	for i, v := range timeoutNames {
+		if s == v {
+			return TimeoutAction(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown timeout action %q", s)
+}
+
+/*
+Reactor runs a command in reaction to sleep signals received from
+a Backend.  Its fields must not be changed after Run is called.
+
+OnSleep, OnWakeup, OnLock, OnUnlock, OnIdle, OnActive and
+OnLocked, if non-nil, are called from the event loop when the
+corresponding event is handled, and should not block.
+*/
+type Reactor struct {
+	Backend    Backend       // sleep signal backend
+	Cmd        []string      // command and arguments
+	Delay      time.Duration // delay after command
+	Background bool          // run command in the background
+	Notify     []string      // notifier command and arguments
+
+	// PassLock, if true, makes the command run upon sleep get
+	// a duplicate of the sleep inhibit lock file descriptor as
+	// fd 3, with its number in $XSS_SLEEP_LOCK_FD, like xss-lock
+	// does, if the Backend is a LockPasser.  The command should
+	// close it when the screen is locked.
+	PassLock bool
+
+	// ReadyFD, if 3 or more, is the file descriptor number of
+	// a pipe passed to the command, also given in
+	// $USSSSR_READY_FD.  The command writes a newline to it when
+	// the screen is locked, whereupon the sleep inhibit lock is
+	// released without waiting for Delay or the command to exit.
+	// In background mode the lock is held for up to the timeout
+	// rather than Delay.
+	ReadyFD int
+
+	// Confirm, if true, makes the sleep inhibit lock be held
+	// until the screen lock is confirmed by a locked event or by
+	// Check, if non-nil, exiting with status 0, or until the
+	// deadline, rather than for Delay after the command.
+	Confirm bool
+	Check   []string // lock check command and arguments
+
+	// Start, if non-nil, is called to start the command instead
+	// of executing Cmd, e.g., a built-in Action.  It must return
+	// an error if the command cannot be started, otherwise send
+	// the wait status to stopped upon termination.
+	Start Action
+
+	// Fallback lists lockers tried in turn if the command (or
+	// the preceding fallback) cannot be started, or exits with
+	// non-zero status while the sleep inhibit lock is held.
+	// If all of them fail, Run returns ErrFailed if
+	// ExitOnFailure is true.
+	Fallback      []Locker
+	ExitOnFailure bool
+
+	// Failure determines what happens when all lockers fail
+	// while sleep is inhibited.  With FailHold and FailBlock,
+	// the sleep inhibit lock is held until the deadline while
+	// the lockers are retried.  With FailBlock, a block inhibit
+	// lock is also taken if the Backend is a Blocker, so that
+	// following sleeps are refused until a locker succeeds, and
+	// FailNotify, if non-nil, is run to tell the user.
+	Failure    FailurePolicy
+	FailNotify []string // failure notifier command and arguments
+
+	// Relaunch, if true, makes a background locker be relaunched
+	// if it dies while the session should be locked, that is,
+	// is killed or exits with non-zero status other than
+	// UnlockStatus.  If it dies more than five times a minute,
+	// Run returns ErrCrashing.
+	Relaunch     bool
+	UnlockStatus int // exit status meaning the user unlocked
+
+	// Track, if true, makes Run a child subreaper and commands
+	// run in their own process groups, and a command is deemed
+	// running until all of its descendants, including daemons
+	// that forked away, have exited.  Orphans adopted from the
+	// process groups of the commands are reaped.  Other
+	// children of the process are left alone, but those in
+	// process groups of their own started while a command is
+	// running are taken for daemons forked away from it.  Only
+	// supported on Linux; elsewhere Run returns ErrNoTrack.
+	Track bool
+
+	// TimeoutAction is applied to a foreground command still
+	// running when the sleep deadline passes, which otherwise
+	// keeps later sleep events from running it again.  With
+	// Track, the signals are sent to its process group.
+	TimeoutAction TimeoutAction
+	Grace         time.Duration // between SIGTERM and SIGKILL
+
+	// Busy is applied to sleep and lock events received while
+	// a foreground command is running or less than MinInterval
+	// after the command was last started; those received while
+	// a background command is running are swallowed.  Events
+	// queued by BusyCoalesce and BusyRestart result in a single
+	// run, no earlier than MinInterval after the last one, and
+	// sleep queues it only until wakeup or the deadline.
+	Busy        BusyPolicy
+	MinInterval time.Duration
+
+	OnSleep  func() // called upon sleep event
+	OnWakeup func() // called upon wakeup event
+	OnLock   func() // called upon lock event
+	OnUnlock func() // called upon unlock event
+	OnIdle   func() // called upon idle event
+	OnActive func() // called upon active event
+	OnLocked func() // called upon locked event
+}
+
+func wait(cmd *exec.Cmd, stopped chan<- error) {
+	stopped <- waitCmd(cmd)
+}
+
+// lockFile returns the sleep inhibit lock file to pass to the
+// command, or nil.
+func (r *Reactor) lockFile() *os.File {
+	p, ok := r.Backend.(LockPasser)
+	if !ok {
+		return nil
+	}
+	f, err := p.LockFile()
+	if err != nil {
+		logln(r.Backend.Name()+".LockFile:", err)
+	}
+	return f
+}
+
+// readReady reads from the readiness pipe until a newline or EOF,
+// sending to ready, if it's not full, upon newline.
+func readReady(f *os.File, ready chan<- struct{}) {
+	defer f.Close()
+	var b [64]byte
+	for {
+		n, err := f.Read(b[:])
+		for _, v := range b[:n] {
+			if v == '\n' {
+				select {
+				case ready <- struct{}{}:
+				default:
+				}
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				logln("ready:", err)
+			}
+			return
+		}
+	}
+}
+
+// run starts the locker, returning an error if it cannot be
+// started.  If the error is nil, the wait status will be sent to
+// stopped upon termination.  If sleep is true, the sleep inhibit
+// lock is passed to the command as configured.  If ReadyFD is
+// set, readiness is sent to ready, which should be buffered.
+func (r *Reactor) run(l Locker, stopped chan<- error, sleep bool, ready chan<- struct{}) (*os.Process, error) {
+	if l.Start != nil {
+		return nil, l.Start(stopped)
+	} else if len(l.Cmd) == 0 {
+		return nil, ErrNoCommand
+	}
+	cmd := exec.Command(l.Cmd[0], l.Cmd[1:]...)
+	var env []string
+	if sleep && r.PassLock {
+		if f := r.lockFile(); f != nil {
+			defer f.Close()
+			cmd.ExtraFiles = []*os.File{f}
+			env = append(env, "XSS_SLEEP_LOCK_FD=3")
+		}
+	}
+	if r.ReadyFD >= 3 {
+		i := r.ReadyFD - 3
+		if i < len(cmd.ExtraFiles) {
+			return nil, ErrReadyFD
+		}
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		defer pw.Close()
+		go readReady(pr, ready)
+		for len(cmd.ExtraFiles) <= i {
+			cmd.ExtraFiles = append(cmd.ExtraFiles, nil)
+		}
+		cmd.ExtraFiles[i] = pw
+		env = append(env, "USSSSR_READY_FD="+strconv.Itoa(r.ReadyFD))
+	}
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if err := startCmd(cmd); err != nil {
+		return nil, err
+	} else if r.Track {
+		go track(cmd, stopped)
+	} else {
+		go wait(cmd, stopped)
+	}
+	return cmd.Process, nil
+}
+
+// signal sends sig to the command process p, or its process group
+// with Track.
+func (r *Reactor) signal(p *os.Process, sig syscall.Signal) {
+	var err error
+	if r.Track {
+		err = syscall.Kill(-p.Pid, sig)
+	} else {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		logln("kill:", err)
+	}
+}
+
+// timedOut applies TimeoutAction to the foreground command process
+// p, returning the SIGKILL timer channel, if any.
+func (r *Reactor) timedOut(p *os.Process) <-chan time.Time {
+	if r.TimeoutAction == TimeoutKeep || p == nil {
+		logln("command timed out, consider using -b")
+		return nil
+	}
+	logln("command timed out, sending SIGTERM")
+	r.signal(p, syscall.SIGTERM)
+	if r.TimeoutAction == TimeoutKill {
+		return time.After(r.Grace)
+	}
+	return nil
+}
+
+// unlocked returns whether the wait status err means that the
+// user unlocked the screen.
+func (r *Reactor) unlocked(err error) bool {
+	if err == nil {
+		return true
+	}
+	var ee *exec.ExitError
+	return r.UnlockStatus != 0 && errors.As(err, &ee) &&
+		ee.ExitCode() == r.UnlockStatus
+}
+
+// notify starts the notifier command args, if any, returning its
+// process.
+func notify(args []string) *os.Process {
+	if len(args) == 0 {
+		return nil
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := startCmd(cmd); err != nil {
+		logln("notify:", err)
+		return nil
+	}
+	go waitCmd(cmd)
+	return cmd.Process
+}
+
+// cancelNotify kills the notifier command if it's running.
+func cancelNotify(p **os.Process) {
+	if *p != nil {
+		debugln("killing notifier")
+		(*p).Kill()
+		*p = nil
+	}
+}
+
+// check runs the check command every checkInterval until it
+// exits with status 0, then sends to confirmed, or ctx is done.
+func (r *Reactor) check(ctx context.Context, confirmed chan<- struct{}) {
+	for {
+		cmd := exec.CommandContext(ctx, r.Check[0], r.Check[1:]...)
+		if startCmd(cmd) == nil && waitCmd(cmd) == nil {
+			select {
+			case confirmed <- struct{}{}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(checkInterval):
+		}
+	}
+}
+
+// setTimeout sets *timeout according to the maximum inhibit
+// delay max.  max is reduced by a safety margin of 1/16.  In
+// background mode without Confirm or ReadyFD max is then capped
+// to r.Delay.
+func (r *Reactor) setTimeout(timeout *time.Duration, max time.Duration) {
+	max -= max >> 4 // safety margin of 1/16 of maximum inhibit delay
+	if r.Background && !r.Confirm && r.ReadyFD < 3 && max > r.Delay {
+		max = r.Delay
+	}
+	if max != *timeout {
+		*timeout = max
+		debugln("timeout =", max)
+	}
+}
+
+func (r *Reactor) updateTimeout(timeout *time.Duration) {
+	if max, err := r.Backend.MaxInhibit(); err != nil {
+		logln(r.Backend.Name()+".MaxInhibit:", err)
+	} else if max >= 0 {
+		r.setTimeout(timeout, max)
+	}
+}
+
+// holdTimeout returns the maximum inhibit delay minus the safety
+// margin, regardless of Delay.
+func (r *Reactor) holdTimeout() time.Duration {
+	max, err := r.Backend.MaxInhibit()
+	if err != nil {
+		logln(r.Backend.Name()+".MaxInhibit:", err)
+	}
+	if err != nil || max < 0 {
+		max = defaultTimeout
+	}
+	return max - max>>4
+}
+
+func (r *Reactor) release() {
+	debugln("releasing inhibit lock")
+	if err := r.Backend.Release(); err != nil {
+		logln(r.Backend.Name()+".Release:", err)
+	}
+}
+
+/*
+Run runs the event loop until ctx is done, returning ctx.Err(),
+or the signal channel is closed, returning ErrClosed, or a
+relaunched locker keeps crashing, returning ErrCrashing.  If the
+release timer is running, the sleep inhibit lock is released
+before returning.  The Backend is not closed.
+
+The event loop reacts to sleep, wakeup and lock events, command
+termination (exited or killed) and release timer expiring,
+tracking state represented by two boolean variables:
+  - running, indicating whether the command is running;
+  - locked, indicating whether the release timer is running.
+
+After sleep event is received, the command is run if it's not
+already running, and the release timer is started, stopped and
+restarted as needed.  When the release timer expires, the backend
+Release method is called, allowing the system to sleep.  After
+lock event is received, the command is run if it's not already
+running; sleep is not inhibited.
+
+After idle event is received, the notifier command is run to warn
+the user of the upcoming lock, unless it or the command is already
+running.  The notifier is killed upon active, lock or sleep event,
+so that a sleep locks immediately without a warning phase.
+
+With Confirm, after sleep event the release timer is not set to
+Delay after the command exits, but kept running until the screen
+lock is confirmed by locked event or the check command, whereupon
+the sleep inhibit lock is released.  If the deadline passes first,
+it is logged.
+
+If the command cannot be started, the Fallback lockers are tried
+in turn, and if a locker exits with non-zero status while the
+release timer is running, the next one is run within the same
+deadline.  If none is left, the failure is logged and handled
+according to Failure.  While holding the sleep inhibit lock, the
+lockers are retried every second until one starts or the release
+timer expires.  A block inhibit lock taken is released once a
+locker succeeds: a foreground command exits with status 0, a
+background command starts, or locked event is received.
+
+With Relaunch in background mode, the session is deemed to be
+locked from the time a locker starts until it exits normally or
+unlock event is received.  A locker dying in between is relaunched
+immediately, falling back to the following lockers if it can't be
+started.
+
+Sleep and lock events received while a foreground command is
+running, or less than MinInterval after the command was last
+started, are handled according to Busy: swallowed, or queued to be
+run once, after the command exits and MinInterval passes, the
+running command being terminated first with BusyRestart.  A queued
+sleep holds the sleep inhibit lock for the queued run, up to the
+timeout, and is dropped upon wakeup.  Events received while a
+background command is running, keeping the screen locked, are
+swallowed.
+
+With Track, command termination is reported when the command and
+all of its descendants have exited, with the command's status.
+This keeps daemonizing lockers from running in more than one copy,
+but a foreground command leaving a locker behind times out; such a
+command should be run in the background.
+
+With ReadyFD, once the command signals readiness while the release
+timer is running, the sleep inhibit lock is released immediately,
+in foreground and background mode alike.  In background mode the
+timeout is then not capped to Delay, as with Confirm.
+
+The systemd and ConsoleKit2 backends take a sleep inhibit lock at
+start and when wakeup signal is received.  Any old lock held is
+released prior to that.  If inhibiting fails, no state transition
+or action is performed.  Their Release method releases the lock.
+
+The UPower backend doesn't support inhibiting sleep.  Its Release
+method is a no-op.
+
+State transitions and actions.  Empty: no action beyond state
+change; "-": event does not occur in state.
+
+	R=running, L=locked, T=true, f=false.
+	+-----------------------+---------+-----------------------+
+	|                       |         | initial state (R,L)   |
+	|                       | state   +-----+-----+-----+-----+
+	| event received        | change  | f,f | f,T | T,f | T,T |
+	+-----------------------+---------+-----+-----+-----+-----+
+	| sleep, exec ok        | R=T L=T | [a] | [a] | -   | -   |
+	| sleep, exec failed    |     L=T | [k] | [k] | -   | -   |
+	| sleep (no exec)       |     L=T | [n] | [n] | [n] | [n] |
+	| lock, exec ok         | R=T     |     |     | -   | -   |
+	| lock, exec failed     |         |     |     | -   | -   |
+	| lock (no exec)        |         | [n] | [n] | [n] | [n] |
+	| unlock                |         |     |     |     |     |
+	| idle                  |         | [f] | [f] |     |     |
+	| active                |         | [g] | [g] | [g] | [g] |
+	| locked                |     L=f |     | [h] |     | [h] |
+	| command ready         |     L=f |     | [i] |     | [i] |
+	| wakeup, inhibit ok    |     L=f |     | [c] |     | [c] |
+	| release timer expired |     L=f | -   | [d] | -   | [d] |
+	| command exited 0      | R=f     | -   | -   | [o] | [e] |
+	| command failed        | R=f     | -   | -   | [o] | [j] |
+	| retry, exec ok        | R=T     | -   | [l] | -   | -   |
+	| SIGKILL timer expired |         | -   | -   | [m] | [m] |
+	| run interval passed   |         | [o] | [o] |     |     |
+	+-----------------------+---------+-----+-----+-----+-----+
+	[a] set release timer to timeout and deadline to now+timeout.
+	[b] set release timer to expire immediately.
+	[c] stop release timer.
+	[d] release sleep inhibit lock; if a foreground command
+	    is running and the release timer was set by [a] or
+	    [k], not [b] or [e], apply TimeoutAction, setting
+	    SIGKILL timer to Grace with TimeoutKill.
+	[e] in foreground mode, set release timer to delay or
+	    until deadline, whichever is earlier; with Confirm,
+	    keep the release timer.
+	[f] run notifier command, if not running.
+	[g] kill notifier command, if running; also done upon
+	    sleep and lock.
+	[h] with Confirm, if awaiting confirmation, stop release
+	    timer and release sleep inhibit lock (otherwise no
+	    state change); also done when the check command exits
+	    with status 0.
+	[i] stop release timer and release sleep inhibit lock.
+	[j] (exit non-zero or killed) with Relaunch, if the
+	    session should be locked, relaunch the locker (R=T)
+	    unless the status is UnlockStatus; otherwise run the
+	    next fallback locker, if any starts (R=T), keeping the
+	    release timer; otherwise [k], in background mode too.
+	[k] with FailRelease, set release timer to expire
+	    immediately; otherwise set it to the maximum inhibit
+	    delay since the sleep event, uncapped by Delay in
+	    background mode, and retry the lockers until one
+	    starts or it expires.
+	[l] stop retrying; in background mode, set release timer
+	    to Delay unless ReadyFD is set, or with Confirm await
+	    confirmation.
+	[m] send SIGKILL to the command; the timer is stopped
+	    when the command exits.
+	[n] (running, or started less than MinInterval ago) with
+	    BusySwallow, or with a background command running,
+	    sleep does [b] if L=f; otherwise queue a run, sleep
+	    with L=f doing [a] to hold the lock for it, and with
+	    BusyRestart, if running, send SIGTERM to the command
+	    and set SIGKILL timer to Grace.  A run queued by sleep
+	    is dropped upon wakeup and [d].
+	[o] if a run is queued, run the lockers (R=T) if
+	    MinInterval has passed since the last run, otherwise
+	    set run interval timer.  A command terminated by
+	    BusyRestart skips [e] and [j]; [e] keeps the release
+	    timer if a run is queued.
+*/
+func (r *Reactor) Run(ctx context.Context) error {
+	be := r.Backend
+	if r.Track {
+		if err := subreaper(); err != nil {
+			return err
+		}
+		tracking(true)
+		defer tracking(false)
+		rctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go reap(rctx)
+	}
+	var (
+		locked  bool                       // sleep actively inhibited
+		expires bool                       // release timer is deadline
+		running bool                       // command is running
+		start   time.Time                  // sleep event time
+		stopped = make(chan error, 1)      // command status channel
+		timeout = r.Delay                  // inhibit release timeout
+		release = time.NewTimer(time.Hour) // inhibit release timer
+		warning *os.Process                // notifier process
+		proc    *os.Process                // command process, if any
+		kill    <-chan time.Time           // SIGKILL timer
+
+		confirming bool               // awaiting lock confirmation
+		checked    chan struct{}      // check command succeeded
+		stopCheck  context.CancelFunc // stops check command
+		ready      chan struct{}      // command is ready
+
+		lockers = append([]Locker{{r.Cmd, r.Start}}, r.Fallback...)
+		attempt int              // index of locker running
+		retry   <-chan time.Time // retry lockers
+		blocked bool             // block inhibit lock held
+
+		session bool        // session should be locked
+		crashes []time.Time // recent locker crashes
+
+		last       time.Time        // last command start time
+		pending    bool             // rerun queued
+		pendSleep  bool             // ...upon sleep event
+		debounce   <-chan time.Time // MinInterval timer
+		restarting bool             // command terminated for rerun
+	)
+	release.Stop()
+
+	// confirm starts awaiting lock confirmation
+	confirm := func() {
+		confirming = true
+		if len(r.Check) > 0 {
+			var cctx context.Context
+			cctx, stopCheck = context.WithCancel(ctx)
+			checked = make(chan struct{})
+			go r.check(cctx, checked)
+		}
+	}
+	// unconfirm stops awaiting lock confirmation
+	unconfirm := func() {
+		confirming = false
+		if stopCheck != nil {
+			stopCheck()
+			stopCheck, checked = nil, nil
+		}
+	}
+	defer unconfirm()
+	// confirmed releases the lock once the screen is locked
+	confirmed := func() {
+		unconfirm()
+		if !release.Stop() {
+			<-release.C
+		}
+		locked, expires = false, false
+		r.release()
+	}
+	// runLocker runs the lockers from i on until one starts,
+	// returning false if none does.
+	runLocker := func(i int, sleep bool) bool {
+		for ; i < len(lockers); i++ {
+			if i > 0 {
+				logln("falling back to", strings.Join(lockers[i].Cmd, " "))
+			}
+			debugln("running command")
+			var rc chan struct{}
+			if sleep {
+				ready = make(chan struct{}, 1)
+				rc = ready
+			}
+			p, err := r.run(lockers[i], stopped, sleep, rc)
+			if err != nil {
+				logln(err)
+				continue
+			}
+			attempt, proc, last = i, p, time.Now()
+			return true
+		}
+		return false
+	}
+	// failed logs failure of all lockers and handles it
+	// according to r.Failure, returning ErrFailed if Run should
+	// return.  If locked, the release timer must be running.
+	failed := func() error {
+		logln("ALL LOCKERS FAILED")
+		if r.ExitOnFailure {
+			return ErrFailed
+		}
+		if r.Failure == FailBlock && !blocked {
+			err := ErrNoBlock
+			if b, ok := be.(Blocker); ok {
+				err = b.Block()
+			}
+			if err != nil {
+				logln("block:", err)
+			} else {
+				blocked = true
+				logln("sleep blocked until the screen is locked")
+			}
+			notify(r.FailNotify)
+		}
+		if !locked {
+			return nil
+		}
+		unconfirm()
+		if r.Failure == FailRelease {
+			if !release.Stop() {
+				<-release.C
+			}
+			release.Reset(0)
+			expires = false
+			return nil
+		}
+		// hold for the maximum inhibit delay, not capped by
+		// r.Delay as in background mode
+		if !release.Stop() {
+			<-release.C
+		}
+		release.Reset(r.holdTimeout() - time.Since(start))
+		expires = true
+		debugln("holding sleep inhibit lock, retrying")
+		retry = time.After(minRetry)
+		return nil
+	}
+	// succeeded releases the block inhibit lock, if held
+	succeeded := func() {
+		retry = nil
+		if blocked {
+			if err := be.(Blocker).Unblock(); err != nil {
+				logln("unblock:", err)
+			}
+			blocked = false
+			logln("sleep unblocked")
+		}
+	}
+	defer func() {
+		if blocked {
+			be.(Blocker).Unblock()
+		}
+	}()
+	// busy handles sleep or lock event according to r.Busy if
+	// the command is running or was started less than
+	// r.MinInterval ago, returning false if it should be run.
+	busy := func(sleep bool) bool {
+		wait := r.MinInterval - time.Since(last)
+		if !running && wait <= 0 {
+			return false
+		}
+		lg := debugln
+		if sleep {
+			lg = logln
+		}
+		// a background locker running means the screen is
+		// locked, and it's not to be restarted
+		if r.Busy == BusySwallow || running && r.Background {
+			if running {
+				lg("exec: already running")
+			} else {
+				lg("exec: too soon after last run")
+			}
+			return true
+		}
+		pending = true
+		pendSleep = pendSleep || sleep
+		if !running {
+			debugln("exec: too soon after last run, deferring")
+			if debounce == nil {
+				debounce = time.After(wait)
+			}
+		} else if r.Busy == BusyRestart && proc != nil && !restarting {
+			logln("command still running, restarting")
+			restarting = true
+			r.signal(proc, syscall.SIGTERM)
+			if kill == nil {
+				kill = time.After(r.Grace)
+			}
+		} else {
+			debugln("exec: already running, queued")
+		}
+		return true
+	}
+	// rerun runs the lockers if queued by busy, the command is
+	// not running and r.MinInterval has passed, returning
+	// ErrFailed if Run should return.
+	rerun := func() error {
+		if !pending || running || debounce != nil {
+			return nil
+		} else if wait := r.MinInterval - time.Since(last); wait > 0 {
+			debounce = time.After(wait)
+			return nil
+		}
+		sleep := pendSleep && locked
+		pending, pendSleep = false, false
+		debugln("running queued command")
+		if sleep {
+			unconfirm()
+		}
+		if !runLocker(0, sleep) {
+			return failed()
+		}
+		running = true
+		if r.Background {
+			session = true
+			succeeded()
+		}
+		if sleep && r.Confirm {
+			confirm()
+		}
+		return nil
+	}
+
+	// The the effective timeout is capped to the maximum
+	// inhibit delay minus a safety margin to account for
+	// code runtime.  It is initially set according to the
+	// default inhibit delay.  With systemd backend the
+	// current maximum inhibit delay is queried and timeout
+	// is adjusted after executing the command.
+	r.setTimeout(&timeout, defaultTimeout)
+
+	// release early if the release timer is running
+	defer cancelNotify(&warning)
+	defer func() {
+		if locked {
+			if !release.Stop() {
+				<-release.C
+			}
+			r.release()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case sig, ok := <-be.Signals():
+			if !ok {
+				return ErrClosed
+			}
+			debugln("signal received:", sig)
+			ev, err := be.Handle(sig)
+			if err != nil {
+				// wake-up signal but Inhibit failed,
+				// or unknown signal
+				logln(be.Name()+".Handle:", err)
+				break
+			} else if ev == None {
+				break
+			} else if ev == Unlock {
+				debugln("unlock")
+				session = false
+				if r.OnUnlock != nil {
+					r.OnUnlock()
+				}
+				break
+			} else if ev == Idle {
+				debugln("idle")
+				if r.OnIdle != nil {
+					r.OnIdle()
+				}
+				if !running && warning == nil {
+					warning = notify(r.Notify)
+				}
+				break
+			} else if ev == Active {
+				debugln("active")
+				if r.OnActive != nil {
+					r.OnActive()
+				}
+				cancelNotify(&warning)
+				break
+			} else if ev == Lock {
+				debugln("lock")
+				if r.OnLock != nil {
+					r.OnLock()
+				}
+				cancelNotify(&warning)
+				if busy(false) {
+					break
+				}
+				if !runLocker(0, false) {
+					if err := failed(); err != nil {
+						return err
+					}
+					break
+				}
+				running = true
+				if r.Background {
+					session = true
+					succeeded()
+				}
+				break
+			} else if ev == Locked {
+				debugln("locked")
+				if r.OnLocked != nil {
+					r.OnLocked()
+				}
+				succeeded()
+				if confirming && locked {
+					debugln("lock confirmed")
+					confirmed()
+				}
+				break
+			} else if ev == Wakeup {
+				debugln("wakeup")
+				if r.OnWakeup != nil {
+					r.OnWakeup()
+				}
+				// Wake-up signal means that the old sleep
+				// inhibit lock was released and a new one
+				// taken.  If the release timer if running,
+				// stop it to avoid releasing the new lock.
+				unconfirm()
+				ready, retry = nil, nil
+				if pendSleep {
+					// the sleep is over
+					pending, pendSleep = false, false
+				}
+				if locked {
+					if !release.Stop() {
+						<-release.C
+					}
+					locked, expires = false, false
+				}
+				break
+			}
+
+			// handling sleep event
+			if r.OnSleep != nil {
+				r.OnSleep()
+			}
+			cancelNotify(&warning)
+			if busy(true) {
+				// if previous timeouts/delays are active,
+				// keep waiting, otherwise release immediately,
+				// or hold until timeout for the queued run
+				if !locked && pending {
+					start = time.Now()
+					locked, expires = true, true
+					r.updateTimeout(&timeout)
+					release.Reset(timeout)
+				} else if !locked {
+					locked, expires = true, false
+					release.Reset(0)
+				}
+				break
+			}
+
+			start = time.Now()
+			if locked && !release.Stop() {
+				<-release.C
+			}
+			locked, expires = true, true
+			unconfirm()
+			started := runLocker(0, true)
+			// release after timeout
+			r.updateTimeout(&timeout)
+			release.Reset(timeout)
+			if !started {
+				// execution failed
+				if err := failed(); err != nil {
+					return err
+				}
+				break
+			}
+			running = true
+			if r.Background {
+				session = true
+				succeeded()
+			}
+			if r.Confirm {
+				confirm()
+			}
+
+		case <-retry:
+			retry = nil
+			if !locked || running {
+				break
+			}
+			if runLocker(0, true) {
+				running = true
+				if r.Background {
+					session = true
+					succeeded()
+					if !r.Confirm && r.ReadyFD < 3 {
+						// release after delay, as
+						// when started upon sleep
+						if !release.Stop() {
+							<-release.C
+						}
+						release.Reset(r.Delay)
+						expires = false
+					}
+				}
+				if r.Confirm {
+					confirm()
+				}
+			} else {
+				retry = time.After(minRetry)
+			}
+
+		case <-ready:
+			ready = nil
+			if locked {
+				debugln("command ready")
+				confirmed()
+			}
+
+		case <-checked:
+			debugln("lock confirmed by check command")
+			confirmed()
+
+		case <-release.C:
+			deadline := expires
+			locked, expires = false, false
+			if pendSleep {
+				logln("queued command not run before deadline")
+				pending, pendSleep = false, false
+			}
+			if retry != nil {
+				logln("SCREEN NOT LOCKED before deadline")
+				retry = nil
+			}
+			if confirming {
+				logln("SCREEN LOCK NOT CONFIRMED before deadline")
+				unconfirm()
+			}
+			if deadline && running && !r.Background && kill == nil {
+				kill = r.timedOut(proc)
+			}
+			r.release()
+
+		case <-debounce:
+			debounce = nil
+			if err := rerun(); err != nil {
+				return err
+			}
+
+		case <-kill:
+			kill = nil
+			logln("command still running, sending SIGKILL")
+			r.signal(proc, syscall.SIGKILL)
+
+		case err := <-stopped:
+			running = false
+			proc, kill = nil, nil
+			if err != nil {
+				logln("wait:", err)
+			}
+			debugln("command finished")
+			if n, ok := be.(Notifier); ok {
+				n.CommandFinished(err)
+			}
+			if restarting {
+				// terminated to be run again
+				restarting, session = false, false
+				if err := rerun(); err != nil {
+					return err
+				}
+				break
+			}
+			if session && r.Relaunch && !r.unlocked(err) {
+				// died while the session should be locked,
+				// relaunch unless crashing repeatedly
+				now := time.Now()
+				for len(crashes) > 0 && now.Sub(crashes[0]) > crashWindow {
+					crashes = crashes[1:]
+				}
+				crashes = append(crashes, now)
+				if len(crashes) > maxCrashes {
+					logln("LOCKER KEEPS CRASHING, giving up")
+					return ErrCrashing
+				}
+				logln("locker died, relaunching")
+				if runLocker(attempt, locked) {
+					running = true
+					succeeded()
+					break
+				}
+				session = false
+				if err := failed(); err != nil {
+					return err
+				}
+				break
+			}
+			session = false
+			if err == nil && !r.Background {
+				succeeded()
+			}
+			if err != nil && locked {
+				// failed before timeout, try the next
+				// locker or handle failure
+				if attempt+1 < len(lockers) &&
+					runLocker(attempt+1, true) {
+					running = true
+					if r.Background {
+						session = true
+						succeeded()
+					}
+					break
+				}
+				if err := failed(); err != nil {
+					return err
+				}
+				break
+			} else if locked && !r.Background && !pending {
+				// foreground, finished before timeout
+				if !release.Stop() {
+					<-release.C
+				}
+				// command exited with status 0, release
+				// after delay or at deadline, whichever is
+				// earlier, or keep awaiting confirmation.
+				delay := timeout - time.Since(start)
+				if delay > r.Delay && !confirming {
+					delay = r.Delay
+				}
+				release.Reset(delay)
+				expires = false
+			}
+			if err := rerun(); err != nil {
+				return err
+			}
+		}
+	}
+}
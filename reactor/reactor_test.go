@@ -0,0 +1,581 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testDelay = 100 * time.Millisecond // Reactor.Delay in tests
+	testSlack = 300 * time.Millisecond // allowed lateness
+)
+
+var errTestStart = errors.New("cannot start")
+
+// testBackend is a DebugBackend fed by the test, reporting
+// starts, releases, block inhibit locks and command termination
+// on channels.
+type testBackend struct {
+	*DebugBackend
+	w        *io.PipeWriter
+	max      time.Duration // maximum inhibit delay
+	started  chan string   // locker started or failed to
+	released chan time.Time
+	blocked  chan bool
+	finished chan error
+}
+
+func newTestBackend() *testBackend {
+	pr, pw := io.Pipe()
+	return &testBackend{
+		DebugBackend: NewDebugBackend(pr),
+		w:            pw,
+		max:          -1,
+		started:      make(chan string, 16),
+		released:     make(chan time.Time, 16),
+		blocked:      make(chan bool, 16),
+		finished:     make(chan error, 16),
+	}
+}
+
+func (be *testBackend) MaxInhibit() (time.Duration, error) {
+	return be.max, nil
+}
+
+func (be *testBackend) Release() error {
+	be.released <- time.Now()
+	return be.DebugBackend.Release()
+}
+
+func (be *testBackend) Block() error   { be.blocked <- true; return nil }
+func (be *testBackend) Unblock() error { be.blocked <- false; return nil }
+
+func (be *testBackend) CommandFinished(err error) {
+	select {
+	case be.finished <- err:
+	default:
+	}
+}
+
+// send feeds DebugBackend commands.
+func (be *testBackend) send(s string) {
+	be.w.Write([]byte(s))
+}
+
+// locker returns an Action reporting as name, which fails to
+// start the first fail times.
+func (be *testBackend) locker(name string, fail int) Action {
+	return func(stopped chan<- error) error {
+		if fail > 0 {
+			fail--
+			be.started <- "!" + name
+			return errTestStart
+		}
+		be.Start(stopped)
+		be.started <- name
+		return nil
+	}
+}
+
+// run runs r with be until the returned function is called,
+// which returns the error returned by Run.
+func (be *testBackend) run(r *Reactor) func() error {
+	r.Backend = be
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan error, 1)
+	go func() { c <- r.Run(ctx) }()
+	return func() error {
+		cancel()
+		err := <-c
+		be.w.Close()
+		be.Close()
+		return err
+	}
+}
+
+// expectStart expects the lockers in names to be started, or
+// fail to start if prefixed with "!", in order.
+func (be *testBackend) expectStart(t *testing.T, names ...string) {
+	t.Helper()
+	for _, v := range names {
+		select {
+		case s := <-be.started:
+			if s != v {
+				t.Fatalf("started %q, want %q", s, v)
+			}
+		case <-time.After(time.Second + testSlack):
+			t.Fatalf("%q not started", v)
+		}
+	}
+}
+
+// expectNoStart expects no locker to be started for d.
+func (be *testBackend) expectNoStart(t *testing.T, d time.Duration) {
+	t.Helper()
+	select {
+	case s := <-be.started:
+		t.Fatalf("started %q unexpectedly", s)
+	case <-time.After(d):
+	}
+}
+
+// expectRelease expects the sleep inhibit lock to be released
+// d after from.
+func (be *testBackend) expectRelease(t *testing.T, from time.Time, d time.Duration) {
+	t.Helper()
+	select {
+	case at := <-be.released:
+		if got := at.Sub(from); got < d || got > d+testSlack {
+			t.Fatalf("released after %v, want %v", got, d)
+		}
+	case <-time.After(d + testSlack):
+		t.Fatalf("not released after %v", d)
+	}
+}
+
+// expectNoRelease expects the sleep inhibit lock not to be
+// released for d.
+func (be *testBackend) expectNoRelease(t *testing.T, d time.Duration) {
+	t.Helper()
+	select {
+	case <-be.released:
+		t.Fatal("released unexpectedly")
+	case <-time.After(d):
+	}
+}
+
+func TestFallback(t *testing.T) {
+	be := newTestBackend()
+	stop := be.run(&Reactor{
+		Delay: testDelay,
+		// first locker has no command, ErrNoCommand
+		Fallback: []Locker{
+			{Start: be.locker("a", 1)},
+			{Start: be.locker("b", 0)},
+			{Start: be.locker("c", 0)},
+		},
+	})
+	defer stop()
+
+	// falls back upon start failure and non-zero exit
+	be.send("s")
+	be.expectStart(t, "!a", "b")
+	be.send("k")
+	be.expectStart(t, "c")
+	be.expectNoRelease(t, testDelay)
+	start := time.Now()
+	be.send("e")
+	be.expectRelease(t, start, testDelay)
+
+	// not locked: no fall back upon failure
+	be.send("w")
+	be.send("l")
+	be.expectStart(t, "a")
+	be.send("k")
+	be.expectNoStart(t, testDelay)
+}
+
+func TestFallbackRelease(t *testing.T) {
+	be := newTestBackend()
+	stop := be.run(&Reactor{
+		Delay:    testDelay,
+		Start:    be.locker("a", 1),
+		Fallback: []Locker{{Start: be.locker("b", 1)}},
+	})
+	defer stop()
+
+	// all lockers failed, released immediately
+	start := time.Now()
+	be.send("s")
+	be.expectStart(t, "!a", "!b")
+	be.expectRelease(t, start, 0)
+
+	// the next sleep runs them again
+	be.send("w")
+	be.send("s")
+	be.expectStart(t, "a")
+	be.send("k")
+	be.expectStart(t, "b")
+	start = time.Now()
+	be.send("k")
+	be.expectRelease(t, start, 0)
+}
+
+func TestExitOnFailure(t *testing.T) {
+	be := newTestBackend()
+	stop := be.run(&Reactor{
+		Delay:         testDelay,
+		Start:         be.locker("a", 1),
+		Fallback:      []Locker{{Cmd: []string{}}},
+		ExitOnFailure: true,
+	})
+	be.send("s")
+	be.expectStart(t, "!a")
+	if err := stop(); err != ErrFailed {
+		t.Fatalf("Run returned %v, want ErrFailed", err)
+	}
+}
+
+// expectBlock expects the block inhibit lock to be taken or
+// released.
+func (be *testBackend) expectBlock(t *testing.T, want bool) {
+	t.Helper()
+	select {
+	case b := <-be.blocked:
+		if b != want {
+			t.Fatalf("blocked = %v, want %v", b, want)
+		}
+	case <-time.After(time.Second + testSlack):
+		t.Fatalf("blocked not set to %v", want)
+	}
+}
+
+const (
+	testMaxInhibit = 1600 * time.Millisecond
+	testHold       = testMaxInhibit - testMaxInhibit>>4
+)
+
+func TestFailHold(t *testing.T) {
+	be := newTestBackend()
+	be.max = testMaxInhibit
+	stop := be.run(&Reactor{
+		Delay:   testDelay,
+		Start:   be.locker("a", 2),
+		Failure: FailHold,
+	})
+	defer stop()
+
+	// retried every second, held until the deadline
+	start := time.Now()
+	be.send("s")
+	be.expectStart(t, "!a", "!a")
+	be.expectRelease(t, start, testHold)
+
+	// the retry succeeds, released after the delay
+	be.send("w")
+	be.send("s")
+	be.expectStart(t, "a")
+	start = time.Now()
+	be.send("e")
+	be.expectRelease(t, start, testDelay)
+}
+
+func TestFailHoldBackground(t *testing.T) {
+	be := newTestBackend()
+	be.max = testMaxInhibit
+	stop := be.run(&Reactor{
+		Delay:      testDelay,
+		Background: true,
+		Start:      be.locker("a", 1),
+		Failure:    FailHold,
+	})
+	defer stop()
+
+	// held past the delay for the retry, then released after
+	// the delay as if started upon sleep
+	be.send("s")
+	be.expectStart(t, "!a")
+	be.expectNoRelease(t, testDelay+testSlack)
+	be.expectStart(t, "a")
+	// the timer may be reset before the start is received
+	be.expectRelease(t, time.Now(), testDelay-testSlack/10)
+}
+
+func TestFailBlock(t *testing.T) {
+	be := newTestBackend()
+	be.max = testMaxInhibit
+	stop := be.run(&Reactor{
+		Delay:   testDelay,
+		Start:   be.locker("a", 1),
+		Failure: FailBlock,
+	})
+	defer stop()
+
+	// blocked until the retried locker succeeds
+	be.send("s")
+	be.expectStart(t, "!a")
+	be.expectBlock(t, true)
+	be.expectStart(t, "a")
+	be.expectNoRelease(t, testDelay)
+	start := time.Now()
+	be.send("e")
+	be.expectBlock(t, false)
+	be.expectRelease(t, start, testDelay)
+}
+
+func TestBusySwallow(t *testing.T) {
+	be := newTestBackend()
+	stop := be.run(&Reactor{Delay: testDelay, Start: be.locker("a", 0)})
+	defer stop()
+
+	be.send("s")
+	be.expectStart(t, "a")
+	be.send("sl")
+	be.send("e")
+	be.expectNoStart(t, testDelay)
+}
+
+func TestBusyCoalesce(t *testing.T) {
+	be := newTestBackend()
+	stop := be.run(&Reactor{
+		Delay: testDelay,
+		Start: be.locker("a", 0),
+		Busy:  BusyCoalesce,
+	})
+	defer stop()
+
+	// any number of events, one run
+	be.send("l")
+	be.expectStart(t, "a")
+	be.send("ll")
+	be.expectNoStart(t, testDelay)
+	be.send("e")
+	be.expectStart(t, "a")
+	be.send("e")
+	be.expectNoStart(t, testDelay)
+
+	// queued sleep holds the lock for the run
+	be.send("l")
+	be.expectStart(t, "a")
+	be.send("s")
+	be.expectNoRelease(t, testDelay)
+	be.send("e")
+	be.expectStart(t, "a")
+	be.expectNoRelease(t, testDelay)
+	start := time.Now()
+	be.send("e")
+	be.expectRelease(t, start, testDelay)
+
+	// wakeup drops queued sleep
+	be.send("w")
+	be.send("l")
+	be.expectStart(t, "a")
+	be.send("sw")
+	be.send("e")
+	be.expectNoStart(t, testDelay)
+}
+
+func TestBusyBackground(t *testing.T) {
+	for _, busy := range []BusyPolicy{BusyCoalesce, BusyRestart} {
+		be := newTestBackend()
+		stop := be.run(&Reactor{
+			Delay:      testDelay,
+			Background: true,
+			Start:      be.locker("a", 0),
+			Busy:       busy,
+		})
+
+		// running background locker swallows events
+		be.send("l")
+		be.expectStart(t, "a")
+		be.send("ls")
+		be.expectNoStart(t, testDelay)
+		be.send("e")
+		be.expectNoStart(t, testDelay)
+		stop()
+	}
+}
+
+func TestMinInterval(t *testing.T) {
+	const interval = 3 * testDelay
+	be := newTestBackend()
+	stop := be.run(&Reactor{
+		Delay:       testDelay,
+		Start:       be.locker("a", 0),
+		Busy:        BusyCoalesce,
+		MinInterval: interval,
+	})
+	defer stop()
+
+	start := time.Now()
+	be.send("l")
+	be.expectStart(t, "a")
+	be.send("e")
+	be.send("ll")
+	be.expectStart(t, "a")
+	if d := time.Since(start); d < interval {
+		t.Fatalf("run again after %v, want %v", d, interval)
+	}
+	be.send("e")
+	be.expectNoStart(t, interval)
+}
+
+func TestBusyRestart(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	name := filepath.Join(t.TempDir(), "runs")
+	be := newTestBackend()
+	stop := be.run(&Reactor{
+		Delay: testDelay,
+		Cmd:   []string{"sh", "-c", "echo >>" + name + "; exec sleep 2"},
+		Busy:  BusyRestart,
+		Grace: testDelay,
+	})
+	defer stop()
+
+	// runs waits for the command to have run want times
+	runs := func(want int) {
+		t.Helper()
+		for end := time.Now().Add(time.Second); ; {
+			b, _ := os.ReadFile(name)
+			n := len(b)
+			if n == want {
+				return
+			} else if n > want || time.Now().After(end) {
+				t.Fatalf("%d runs, want %d", n, want)
+			}
+			time.Sleep(testDelay / 10)
+		}
+	}
+	be.send("l")
+	runs(1)
+	be.send("ll")
+	runs(2)
+	time.Sleep(testDelay)
+	runs(2)
+}
+
+// expectFinish expects the command to finish with status want
+// within d.
+func (be *testBackend) expectFinish(t *testing.T, d time.Duration, want string) {
+	t.Helper()
+	select {
+	case err := <-be.finished:
+		got := "exit 0"
+		if err != nil {
+			got = err.Error()
+		}
+		if got != want {
+			t.Fatalf("command finished with %q, want %q", got, want)
+		}
+	case <-time.After(d):
+		t.Fatalf("command not finished after %v", d)
+	}
+}
+
+// expectNoFinish expects the command not to finish for d.
+func (be *testBackend) expectNoFinish(t *testing.T, d time.Duration) {
+	t.Helper()
+	select {
+	case err := <-be.finished:
+		t.Fatalf("command finished unexpectedly: %v", err)
+	case <-time.After(d):
+	}
+}
+
+func TestTimeoutAction(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	const grace = 2 * testDelay
+	for _, v := range []struct {
+		action TimeoutAction
+		cmd    string
+		after  time.Duration // finished after release
+		want   string
+	}{
+		{TimeoutKeep, "exec sleep 3", -1, ""},
+		{TimeoutTerm, "exec sleep 3", 0, "signal: terminated"},
+		{TimeoutKill, "trap '' TERM; exec sleep 3", grace,
+			"signal: killed"},
+	} {
+		t.Run(v.action.String(), func(t *testing.T) {
+			be := newTestBackend()
+			be.max = testMaxInhibit
+			stop := be.run(&Reactor{
+				Delay:         testDelay,
+				Cmd:           []string{"sh", "-c", v.cmd},
+				TimeoutAction: v.action,
+				Grace:         grace,
+			})
+			defer stop()
+
+			start := time.Now()
+			be.send("s")
+			be.expectRelease(t, start, testHold)
+			if v.after < 0 {
+				be.expectNoFinish(t, grace+testSlack)
+				return
+			} else if v.after > 0 {
+				be.expectNoFinish(t, v.after-testSlack/10)
+			}
+			be.expectFinish(t, testSlack, v.want)
+		})
+	}
+}
+
+func TestTimeoutSwallowed(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	be := newTestBackend()
+	stop := be.run(&Reactor{
+		Delay:         testDelay,
+		Cmd:           []string{"sh", "-c", "exec sleep 1"},
+		TimeoutAction: TimeoutKill,
+		Grace:         testDelay,
+	})
+	defer stop()
+
+	// released immediately, no deadline passed
+	be.send("l")
+	time.Sleep(testDelay)
+	start := time.Now()
+	be.send("s")
+	be.expectRelease(t, start, 0)
+	be.expectFinish(t, time.Second+testSlack, "exit 0")
+}
+
+func TestReadyBackground(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	for _, v := range []struct {
+		name string
+		cmd  string
+		want time.Duration // release after sleep
+	}{
+		{"ready", "sleep 0.5; echo >&3; exec sleep 2", 5 * testDelay},
+		{"timeout", "exec sleep 2", testHold},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			be := newTestBackend()
+			be.max = testMaxInhibit
+			stop := be.run(&Reactor{
+				Delay:      testDelay,
+				Background: true,
+				Cmd:        []string{"sh", "-c", v.cmd},
+				ReadyFD:    3,
+			})
+			defer stop()
+
+			// held past the delay
+			start := time.Now()
+			be.send("s")
+			be.expectRelease(t, start, v.want)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2013, 2024 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	sdDest       = "org.freedesktop.login1"
+	sdPath       = "/org/freedesktop/login1"
+	sdIface      = sdDest + ".Manager"
+	sdInhibit    = sdIface + ".Inhibit"
+	sdMaxInhibit = sdIface + ".InhibitDelayMaxUSec"
+)
+
+type SystemdBackend struct {
+	inhibitor
+}
+
+var (
+	ErrSDInhibit    = errors.New("invalid response from " + sdInhibit)
+	ErrSDMaxInhibit = errors.New("invalid response from " + sdMaxInhibit)
+)
+
+// NewSystemdBackend connects to the system bus and takes a sleep
+// inhibit lock from logind.
+func NewSystemdBackend(ctx context.Context) (Backend, error) {
+	be := SystemdBackend{inhibitor{
+		name:   "systemd",
+		iface:  sdIface,
+		errInh: ErrSDInhibit,
+	}}
+	if err := be.open(ctx, sdDest, sdPath); err != nil {
+		return nil, err
+	}
+	return &be, nil
+}
+
+func (be *SystemdBackend) MaxInhibit() (time.Duration, error) {
+	vari, err := be.obj.GetProperty(sdMaxInhibit)
+	if err != nil {
+		return -1, err
+	}
+	v, ok := vari.Value().(uint64)
+	if !ok {
+		return -1, ErrSDMaxInhibit
+	}
+	const max = uint64((1<<63 - 1) / time.Microsecond)
+	if v > max {
+		v = max // 292 years is enough for anyone
+	}
+	return time.Duration(v) * time.Microsecond, nil
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+var ErrNoTrack = errors.New("tracking descendants is only supported on Linux")
+
+// procs holds the pids of the commands started by this package,
+// so that they aren't reaped as adopted orphans, and while a Run
+// with Track is running, the process groups the commands are run
+// in, so that orphans from other children of this process aren't.
+var procs = struct {
+	sync.Mutex
+	pids   map[int]bool
+	groups map[int]bool
+	track  int // Runs with Track running
+}{pids: make(map[int]bool), groups: make(map[int]bool)}
+
+// tracking registers the start of a Run with Track if on is true,
+// otherwise its end.
+func tracking(on bool) {
+	procs.Lock()
+	defer procs.Unlock()
+	if on {
+		procs.track++
+	} else if procs.track--; procs.track == 0 {
+		procs.groups = make(map[int]bool)
+	}
+}
+
+// startCmd starts cmd, registering its process.  While a Run with
+// Track is running, cmd is run in its own process group.
+func startCmd(cmd *exec.Cmd) error {
+	procs.Lock()
+	defer procs.Unlock()
+	if procs.track > 0 {
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = new(syscall.SysProcAttr)
+		}
+		cmd.SysProcAttr.Setpgid, cmd.SysProcAttr.Pgid = true, 0
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	procs.pids[cmd.Process.Pid] = true
+	if procs.track > 0 {
+		procs.groups[cmd.Process.Pid] = true
+	}
+	return nil
+}
+
+// waitCmd waits for cmd started by startCmd and unregisters its
+// process.
+func waitCmd(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	procs.Lock()
+	delete(procs.pids, cmd.Process.Pid)
+	procs.Unlock()
+	return err
+}
@@ -0,0 +1,279 @@
+//go:build linux
+
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetChildSubreaper = 36  // prctl option
+	sysPidfdOpen        = 434 // pidfd_open system call
+	pPidfd              = 3   // waitid idtype
+	pollIn              = 0x1 // poll event
+)
+
+type pollFd struct {
+	fd              int32
+	events, revents int16
+}
+
+// subreaper makes this process a child subreaper, so that orphaned
+// descendants are reparented to it rather than to init.
+func subreaper() error {
+	_, _, e := syscall.RawSyscall(syscall.SYS_PRCTL,
+		prSetChildSubreaper, 1, 0)
+	if e != 0 {
+		return os.NewSyscallError("prctl", e)
+	}
+	return nil
+}
+
+// pidfdOpen returns a pidfd referring to process pid.
+func pidfdOpen(pid int) (int, error) {
+	fd, _, e := syscall.Syscall(sysPidfdOpen, uintptr(pid), 0, 0)
+	if e != 0 {
+		return -1, e
+	}
+	syscall.CloseOnExec(int(fd))
+	return int(fd), nil
+}
+
+// poll waits for the processes referred to by pidfds fds to exit,
+// until one does if block is true, setting revents.  It returns
+// the number of processes exited.
+func poll(fds []pollFd, block bool) int {
+	var ts *syscall.Timespec
+	if !block {
+		ts = new(syscall.Timespec)
+	}
+	for {
+		n, _, e := syscall.Syscall6(syscall.SYS_PPOLL,
+			uintptr(unsafe.Pointer(&fds[0])), uintptr(len(fds)),
+			uintptr(unsafe.Pointer(ts)), 0, 0, 0)
+		if e != syscall.EINTR {
+			if e != 0 {
+				logln("track: ppoll:", e)
+				return 0
+			}
+			return int(n)
+		}
+	}
+}
+
+// exited returns whether the process referred to by pidfd fd has
+// exited.
+func exited(fd int) bool {
+	return poll([]pollFd{{int32(fd), pollIn, 0}}, false) > 0
+}
+
+// reapFd reaps the process referred to by pidfd fd if it's an
+// exited child.
+func reapFd(fd int) {
+	var info [128]byte // siginfo_t
+	syscall.Syscall6(syscall.SYS_WAITID, pPidfd, uintptr(fd),
+		uintptr(unsafe.Pointer(&info[0])),
+		syscall.WEXITED|syscall.WNOHANG, 0, 0)
+}
+
+// procStat returns the state, parent pid and process group id of
+// process pid.
+func procStat(pid string) (state byte, ppid, pgrp int, ok bool) {
+	b, err := os.ReadFile("/proc/" + pid + "/stat")
+	if err != nil {
+		return
+	}
+	// pid (comm) state ppid pgrp ...
+	if i := bytes.LastIndexByte(b, ')'); i >= 0 {
+		f := bytes.Fields(b[i+1:])
+		if len(f) >= 3 && len(f[0]) == 1 {
+			state = f[0][0]
+			ppid, err = strconv.Atoi(string(f[1]))
+			if err == nil {
+				pgrp, err = strconv.Atoi(string(f[2]))
+			}
+			ok = err == nil
+		}
+	}
+	return
+}
+
+// eachProc calls f for each process.
+func eachProc(f func(pid int, name string)) {
+	d, err := os.ReadDir("/proc")
+	if err != nil {
+		logln("track:", err)
+		return
+	}
+	for _, v := range d {
+		if pid, err := strconv.Atoi(v.Name()); err == nil {
+			f(pid, v.Name())
+		}
+	}
+}
+
+/*
+tracker tracks the descendants of a command run in process group
+pgrp by this process, a child subreaper.  They are the processes
+in the process group, and the orphans reparented to this process
+that have left its process group for one of their own; the
+latter are assumed to descend from the command, unless they are
+commands started by startCmd or in their process groups.  Each is
+referred to by a pidfd, so that reuse of its pid after it exits
+doesn't confuse tracking.
+
+Processes only join the process group or get reparented to this
+process while a process tracked is alive, or upon its exit, so
+the processes are looked for only then.
+*/
+type tracker struct {
+	pgrp int         // command process group
+	self int         // this process
+	own  int         // this process's process group
+	fds  map[int]int // pidfds of tracked processes by pid
+}
+
+// match returns whether process pid with the given parent and
+// process group is tracked.
+func (t *tracker) match(pid, ppid, pgrp int) bool {
+	if pgrp == t.pgrp {
+		return true
+	} else if ppid != t.self || pgrp == t.own {
+		return false
+	}
+	procs.Lock()
+	defer procs.Unlock()
+	return !procs.pids[pid] && !procs.groups[pgrp]
+}
+
+// scan finds the descendants not tracked yet, reaping those that
+// are zombie children.
+func (t *tracker) scan() {
+	eachProc(func(pid int, name string) {
+		if _, dup := t.fds[pid]; dup {
+			return
+		}
+		state, ppid, pgrp, ok := procStat(name)
+		if !ok || !t.match(pid, ppid, pgrp) || state == 'Z' && ppid != t.self {
+			// zombies are reaped by their parents
+			return
+		}
+		fd, err := pidfdOpen(pid)
+		if err != nil {
+			return
+		}
+		// the process may have exited before pidfdOpen,
+		// and its pid reused
+		if _, ppid, pgrp, ok = procStat(name); !ok ||
+			!t.match(pid, ppid, pgrp) || exited(fd) {
+			reapFd(fd)
+			syscall.Close(fd)
+			return
+		}
+		debugln("tracking process", pid)
+		t.fds[pid] = fd
+	})
+}
+
+// wait waits until at least one tracked process exits, and stops
+// tracking the ones that have exited.
+func (t *tracker) wait() {
+	var (
+		fds  = make([]pollFd, 0, len(t.fds))
+		pids = make([]int, 0, len(t.fds))
+	)
+	for pid, fd := range t.fds {
+		fds = append(fds, pollFd{int32(fd), pollIn, 0})
+		pids = append(pids, pid)
+	}
+	if poll(fds, true) == 0 {
+		return
+	}
+	for i, v := range fds {
+		if v.revents != 0 {
+			reapFd(int(v.fd))
+			syscall.Close(int(v.fd))
+			delete(t.fds, pids[i])
+		}
+	}
+}
+
+// track waits for cmd to exit, then for its descendants, and sends
+// the command's exit status to stopped.
+func track(cmd *exec.Cmd, stopped chan<- error) {
+	err := waitCmd(cmd)
+	t := tracker{
+		pgrp: cmd.Process.Pid,
+		self: os.Getpid(),
+		own:  syscall.Getpgrp(),
+		fds:  make(map[int]int),
+	}
+	for {
+		t.scan()
+		if len(t.fds) == 0 {
+			break
+		}
+		t.wait()
+	}
+	stopped <- err
+}
+
+// reap reaps the zombie children of this process adopted as a
+// child subreaper from the process groups of commands started by
+// startCmd, until ctx is done.  Orphans of the notifier, check and
+// helper commands would otherwise be left zombies, as they aren't
+// tracked.  Process groups left empty are forgotten.
+func reap(ctx context.Context) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGCHLD)
+	defer signal.Stop(c)
+	self := os.Getpid()
+	for {
+		procs.Lock()
+		live := make(map[int]bool)
+		eachProc(func(pid int, name string) {
+			state, ppid, pgrp, ok := procStat(name)
+			if !ok || !procs.groups[pgrp] {
+				return
+			} else if state == 'Z' && ppid == self && !procs.pids[pid] {
+				syscall.Wait4(pid, nil, syscall.WNOHANG, nil)
+				return
+			}
+			live[pgrp] = true
+		})
+		for g := range procs.groups {
+			if !live[g] && !procs.pids[g] {
+				delete(procs.groups, g)
+			}
+		}
+		procs.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-c:
+		}
+	}
+}
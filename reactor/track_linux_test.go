@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestTrack(t *testing.T) {
+	for _, v := range []string{"sh", "setsid"} {
+		if _, err := exec.LookPath(v); err != nil {
+			t.Skip(err)
+		}
+	}
+	be := newTestBackend()
+	stop := be.run(&Reactor{
+		Delay: testDelay,
+		// leave an orphan behind in a new process group
+		Cmd: []string{"sh", "-c",
+			"setsid sleep 0.5 & sleep 0.5 & exit 0"},
+		Track: true,
+	})
+	defer stop()
+
+	// the command is running until its descendants exit
+	be.send("l")
+	be.expectNoFinish(t, 2*testDelay)
+	be.expectFinish(t, time.Second, "exit 0")
+
+	// children of this process are left alone
+	be.send("l")
+	var cmds [20]*exec.Cmd
+	for i := range cmds {
+		cmds[i] = exec.Command("sh", "-c", "exit 0")
+		if err := cmds[i].Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(testDelay)
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	be.expectFinish(t, time.Second, "exit 0")
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+// Predicate is a condition on a signal argument.
+type Predicate struct {
+	Arg    int    // argument index
+	Value  string // argument value, as formatted by fmt.Sprint
+	Negate bool   // argument must not be equal to Value
+}
+
+// match reports whether the predicate holds for body.
+func (p Predicate) match(body []interface{}) bool {
+	if p.Arg >= len(body) {
+		return false
+	}
+	v := body[p.Arg]
+	if vari, ok := v.(dbus.Variant); ok {
+		v = vari.Value()
+	}
+	return (fmt.Sprint(v) == p.Value) != p.Negate
+}
+
+// Trigger describes a user-defined signal generating an event.
+type Trigger struct {
+	Session bool        // use session bus instead of system bus
+	Rule    string      // match rule
+	Preds   []Predicate // conditions on arguments
+	Event   Event       // event generated
+}
+
+// ParseEvent returns the Event called s.
+func ParseEvent(s string) (Event, error) {
+	for i, v := range eventNames {
+		if s == v && Event(i) != None {
+			return Event(i), nil
+		}
+	}
+	return None, fmt.Errorf("unknown event %q", s)
+}
+
+// parsePredicate parses a predicate of the form "argN==VALUE" or
+// "argN!=VALUE".
+func parsePredicate(s string) (Predicate, error) {
+	var p Predicate
+	i := strings.Index(s, "!=")
+	if p.Negate = i >= 0; !p.Negate {
+		i = strings.Index(s, "==")
+	}
+	if i < 0 {
+		return p, fmt.Errorf("invalid predicate %q", s)
+	}
+	arg := strings.TrimSpace(s[:i])
+	n, err := strconv.Atoi(strings.TrimPrefix(arg, "arg"))
+	if err != nil || n < 0 || !strings.HasPrefix(arg, "arg") {
+		return p, fmt.Errorf("invalid predicate %q", s)
+	}
+	p.Arg = n
+	p.Value = strings.Trim(strings.TrimSpace(s[i+2:]), "'")
+	return p, nil
+}
+
+/*
+ParseTrigger parses a trigger of the form
+
+	BUS;RULE;PREDICATES;EVENT
+
+where BUS is "system" or "session", RULE is a D-Bus match rule,
+PREDICATES is a comma-separated, possibly empty, list of
+predicates of the form "argN==VALUE" or "argN!=VALUE", and EVENT
+is "sleep", "wakeup" or "lock".  E.g.:
+
+	system;type='signal',interface='com.example.Dock',member='Changed';arg0==false;lock
+*/
+func ParseTrigger(s string) (*Trigger, error) {
+	f := strings.Split(s, ";")
+	if len(f) != 4 {
+		return nil, fmt.Errorf("invalid trigger %q", s)
+	}
+	var t Trigger
+	switch f[0] {
+	case "system":
+	case "session":
+		t.Session = true
+	default:
+		return nil, fmt.Errorf("invalid bus %q", f[0])
+	}
+	if t.Rule = strings.TrimSpace(f[1]); t.Rule == "" {
+		return nil, fmt.Errorf("invalid trigger %q", s)
+	}
+	for _, v := range strings.Split(f[2], ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		p, err := parsePredicate(v)
+		if err != nil {
+			return nil, err
+		}
+		t.Preds = append(t.Preds, p)
+	}
+	var err error
+	if t.Event, err = ParseEvent(strings.TrimSpace(f[3])); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+/*
+TriggerBackend generates events upon user-defined signals: each
+signal matching the trigger's match rule for which all its
+predicates hold generates the trigger's event.  Sleep can't be
+inhibited; Release is a no-op.
+*/
+type TriggerBackend struct {
+	bus
+	t *Trigger
+}
+
+// NewTriggerBackend connects to the bus and installs the
+// trigger's match rule.
+func NewTriggerBackend(ctx context.Context, t *Trigger) (Backend, error) {
+	be := TriggerBackend{t: t}
+	connect := dbus.ConnectSystemBus
+	if t.Session {
+		connect = dbus.ConnectSessionBus
+	}
+	if err := be.dial(ctx, connect, t.Rule); err != nil {
+		return nil, err
+	}
+	return &be, nil
+}
+
+func (*TriggerBackend) Name() string    { return "trigger" }
+func (*TriggerBackend) Release() error  { return nil }
+func (be *TriggerBackend) Close() error { return be.close() }
+
+func (*TriggerBackend) MaxInhibit() (time.Duration, error) {
+	return -1, nil
+}
+
+func (be *TriggerBackend) Handle(sig *dbus.Signal) (Event, error) {
+	if sig.Sender == "org.freedesktop.DBus" {
+		return None, ErrDBusSignal
+	}
+	for _, p := range be.t.Preds {
+		if !p.match(sig.Body) {
+			return None, nil
+		}
+	}
+	return be.t.Event, nil
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"reflect"
+	"testing"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+func TestParsePredicate(t *testing.T) {
+	for _, v := range []struct {
+		s    string
+		want Predicate
+		ok   bool
+	}{
+		{"arg0==true", Predicate{0, "true", false}, true},
+		{"arg1!=foo", Predicate{1, "foo", true}, true},
+		{" arg2 == 'bar baz' ", Predicate{2, "bar baz", false}, true},
+		{"arg3==", Predicate{3, "", false}, true},
+		{"arg0!=a==b", Predicate{0, "a==b", true}, true},
+		{"arg0=true", Predicate{}, false},
+		{"arg==true", Predicate{}, false},
+		{"0==true", Predicate{}, false},
+		{"argx==true", Predicate{}, false},
+		{"arg-1==true", Predicate{}, false},
+		{"", Predicate{}, false},
+	} {
+		p, err := parsePredicate(v.s)
+		if (err == nil) != v.ok {
+			t.Errorf("parsePredicate(%q): error %v", v.s, err)
+		} else if v.ok && p != v.want {
+			t.Errorf("parsePredicate(%q) = %+v, want %+v",
+				v.s, p, v.want)
+		}
+	}
+}
+
+func TestParseTrigger(t *testing.T) {
+	const rule = "type='signal',interface='com.example.Dock',member='Changed'"
+	for _, v := range []struct {
+		s    string
+		want *Trigger
+	}{
+		{"system;" + rule + ";arg0==false;lock",
+			&Trigger{Rule: rule, Preds: []Predicate{{0, "false", false}},
+				Event: Lock}},
+		{"session; " + rule + " ;;sleep",
+			&Trigger{Session: true, Rule: rule, Event: Sleep}},
+		{"system;" + rule + ";arg0==a, ,arg1!=b;wakeup",
+			&Trigger{Rule: rule, Preds: []Predicate{
+				{0, "a", false}, {1, "b", true},
+			}, Event: Wakeup}},
+		{"system;" + rule + "; wakeup", nil},
+		{"system;" + rule + ";;lock;", nil},
+		{"user;" + rule + ";;lock", nil},
+		{"system; ;;lock", nil},
+		{"system;" + rule + ";arg0=1;lock", nil},
+		{"system;" + rule + ";;none", nil},
+		{"system;" + rule + ";;resume", nil},
+	} {
+		tr, err := ParseTrigger(v.s)
+		if v.want == nil {
+			if err == nil {
+				t.Errorf("ParseTrigger(%q) = %+v, want error",
+					v.s, tr)
+			}
+		} else if err != nil {
+			t.Errorf("ParseTrigger(%q): %v", v.s, err)
+		} else if !reflect.DeepEqual(tr, v.want) {
+			t.Errorf("ParseTrigger(%q) = %+v, want %+v",
+				v.s, tr, v.want)
+		}
+	}
+}
+
+func TestTriggerHandle(t *testing.T) {
+	be := &TriggerBackend{t: &Trigger{
+		Preds: []Predicate{{0, "false", false}, {1, "dock0", true}},
+		Event: Lock,
+	}}
+	for _, v := range []struct {
+		body []interface{}
+		want Event
+	}{
+		{[]interface{}{false, "dock1"}, Lock},
+		{[]interface{}{dbus.MakeVariant(false), "dock1"}, Lock},
+		{[]interface{}{true, "dock1"}, None},
+		{[]interface{}{false, "dock0"}, None},
+		{[]interface{}{false}, None},
+		{nil, None},
+	} {
+		ev, err := be.Handle(&dbus.Signal{Body: v.body})
+		if err != nil || ev != v.want {
+			t.Errorf("Handle(%v) = %v, %v; want %v",
+				v.body, ev, err, v.want)
+		}
+	}
+	sig := &dbus.Signal{Sender: "org.freedesktop.DBus"}
+	if _, err := be.Handle(sig); err != ErrDBusSignal {
+		t.Errorf("Handle(bus signal) = %v, want ErrDBusSignal", err)
+	}
+}
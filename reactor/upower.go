@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2013, 2024, 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	upDest     = "org.freedesktop.UPower"
+	upPath     = "/org/freedesktop/UPower"
+	upIface    = upDest
+	upTest     = upDest + ".SuspendAllowed"
+	upVersion  = upDest + ".DaemonVersion"
+	upFilter   = "type='signal',interface='" + upIface + "',member="
+	upSleep    = "NotifySleep"
+	upResume   = "NotifyResume"
+	upSleeping = "Sleeping" // UPower 0.9 legacy
+	upResuming = "Resuming" // UPower 0.9 legacy
+)
+
+var ErrUPVersion = errors.New("UPower version has no sleep signals")
+
+/*
+UPowerBackend is the backend for UPower versions before 0.99,
+which broadcast sleep and resume signals.  UPower 0.99 and later
+leave sleep to logind.
+
+UPower 0.9 sends the legacy signals Sleeping and Resuming in
+addition to NotifySleep and NotifyResume, which were introduced
+later.  The legacy signals are handled until NotifySleep or
+NotifyResume is received.
+
+UPower doesn't support inhibiting sleep.  Release is a no-op.
+*/
+type UPowerBackend struct {
+	bus
+	notify bool // NotifySleep or NotifyResume received
+}
+
+// parseVersion returns the major and minor version numbers in s.
+func parseVersion(s string) (major, minor int, err error) {
+	f := strings.SplitN(s, ".", 3)
+	if len(f) < 2 {
+		return 0, 0, fmt.Errorf("invalid version %q", s)
+	}
+	if major, err = strconv.Atoi(f[0]); err == nil {
+		minor, err = strconv.Atoi(f[1])
+	}
+	return
+}
+
+// checkVersion checks that UPower has sleep signals.  If the
+// DaemonVersion property cannot be read, SuspendAllowed, removed
+// in UPower 0.99, is called instead.
+func (be *UPowerBackend) checkVersion(ctx context.Context) error {
+	obj := be.conn.Object(upDest, upPath)
+	vari, err := obj.GetProperty(upVersion)
+	if err != nil {
+		debugln("UPower:", err)
+		return obj.CallWithContext(ctx, upTest, 0).Err
+	}
+	s, _ := vari.Value().(string)
+	major, minor, err := parseVersion(s)
+	if err != nil {
+		return err
+	}
+	debugln("UPower version", s)
+	if major > 0 || minor >= 99 {
+		return fmt.Errorf("%w: %s", ErrUPVersion, s)
+	}
+	return nil
+}
+
+// NewUPowerBackend connects to the system bus and checks that
+// UPower is available and has sleep signals.
+func NewUPowerBackend(ctx context.Context) (Backend, error) {
+	var be UPowerBackend
+	if err := be.open(ctx, upFilter+upSleep, upFilter+upResume,
+		upFilter+upSleeping, upFilter+upResuming); err != nil {
+		return nil, err
+	}
+	if err := be.checkVersion(ctx); err != nil {
+		be.close()
+		return nil, err
+	}
+	return &be, nil
+}
+
+func (*UPowerBackend) Name() string    { return "UPower" }
+func (*UPowerBackend) Release() error  { return nil }
+func (be *UPowerBackend) Close() error { return be.close() }
+
+// dropLegacy stops handling legacy signals.
+func (be *UPowerBackend) dropLegacy() {
+	if be.notify {
+		return
+	}
+	be.notify = true
+	debugln("UPower: ignoring legacy signals")
+	for _, v := range []string{upSleeping, upResuming} {
+		if err := be.remove(upFilter + v); err != nil {
+			logln("UPower:", err)
+		}
+	}
+}
+
+func (be *UPowerBackend) Handle(sig *dbus.Signal) (Event, error) {
+	if sig.Path != upPath {
+		return None, ErrDBusSignal
+	}
+	switch sig.Name {
+	case upIface + "." + upSleep:
+		be.dropLegacy()
+		return Sleep, nil
+	case upIface + "." + upResume:
+		be.dropLegacy()
+		return Wakeup, nil
+	case upIface + "." + upSleeping:
+		if !be.notify {
+			return Sleep, nil
+		}
+	case upIface + "." + upResuming:
+		if !be.notify {
+			return Wakeup, nil
+		}
+	}
+	return None, ErrDBusSignal
+}
+
+func (*UPowerBackend) MaxInhibit() (time.Duration, error) {
+	return -1, nil
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	for _, v := range []struct {
+		s            string
+		major, minor int
+		ok           bool
+	}{
+		{"0.9.23", 0, 9, true},
+		{"0.99.20", 0, 99, true},
+		{"1.90.2", 1, 90, true},
+		{"0.9", 0, 9, true},
+		{"0.9.x", 0, 9, true},
+		{"", 0, 0, false},
+		{"1", 0, 0, false},
+		{"a.9", 0, 0, false},
+		{"0.9rc1", 0, 0, false},
+		{"0..1", 0, 0, false},
+	} {
+		major, minor, err := parseVersion(v.s)
+		if (err == nil) != v.ok {
+			t.Errorf("parseVersion(%q): error %v", v.s, err)
+		} else if v.ok && (major != v.major || minor != v.minor) {
+			t.Errorf("parseVersion(%q) = %d, %d; want %d, %d",
+				v.s, major, minor, v.major, v.minor)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+// X11 protocol constants
+const (
+	x11SigName        = "x11.screensaver" // name of synthesized signals
+	x11SSExt          = "MIT-SCREEN-SAVER"
+	x11AuthName       = "MIT-MAGIC-COOKIE-1"
+	x11GetInputFocus  = 43  // core opcodes
+	x11QueryExtension = 98  //
+	x11ForceSS        = 115 //
+	x11SSQueryVersion = 0   // MIT-SCREEN-SAVER minor opcodes
+	x11SSSelectInput  = 2   //
+	x11SSNotifyMask   = 1   // ScreenSaverNotifyMask
+	x11SSOn           = 1   // ScreenSaverNotify state
+	x11Error          = 0   // server message types
+	x11Reply          = 1   //
+)
+
+var (
+	ErrX11Display = errors.New("x11: invalid display")
+	ErrX11NoSS    = errors.New("x11: no " + x11SSExt + " extension")
+)
+
+var x11Order = binary.LittleEndian // client byte order
+
+// xconn is a minimal X11 client connection, speaking the protocol
+// in little-endian byte order.
+type xconn struct {
+	c    net.Conn
+	r    *bufio.Reader
+	root uint32 // root window of the default screen
+}
+
+// parseDisplay parses the display name, returning the network,
+// address and display number.
+func parseDisplay(display string) (network, addr, num string, err error) {
+	i := strings.LastIndexByte(display, ':')
+	if i < 0 {
+		return "", "", "", ErrX11Display
+	}
+	host, num := display[:i], display[i+1:]
+	if i = strings.IndexByte(num, '.'); i >= 0 {
+		num = num[:i] // screen
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 0 {
+		return "", "", "", ErrX11Display
+	}
+	switch host {
+	case "", "unix":
+		return "unix", "/tmp/.X11-unix/X" + num, num, nil
+	}
+	return "tcp", net.JoinHostPort(host, strconv.Itoa(6000+n)), num, nil
+}
+
+// xauth returns the authorization cookie for display number num
+// from the authority file, or nil if there is none.
+func xauth(num string) []byte {
+	name := os.Getenv("XAUTHORITY")
+	if name == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		name = filepath.Join(home, ".Xauthority")
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	hostname, _ := os.Hostname()
+	r := bufio.NewReader(f)
+	str := func() ([]byte, error) {
+		var n uint16
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, err
+		}
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	for {
+		var family uint16
+		if binary.Read(r, binary.BigEndian, &family) != nil {
+			return nil
+		}
+		var e [4][]byte // address, number, name, data
+		for i := range e {
+			if e[i], err = str(); err != nil {
+				return nil
+			}
+		}
+		// FamilyLocal (256) or FamilyWild (65535)
+		if (family == 256 && string(e[0]) == hostname ||
+			family == 65535) &&
+			(len(e[1]) == 0 || string(e[1]) == num) &&
+			string(e[2]) == x11AuthName {
+			return e[3]
+		}
+	}
+}
+
+// pad4 returns n rounded up to a multiple of 4.
+func pad4(n int) int { return (n + 3) &^ 3 }
+
+// dialX11 connects to the X server given by $DISPLAY.
+func dialX11(ctx context.Context) (*xconn, error) {
+	network, addr, num, err := parseDisplay(os.Getenv("DISPLAY"))
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	c, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	x := &xconn{c: c, r: bufio.NewReader(c)}
+	if dl, ok := ctx.Deadline(); ok {
+		c.SetDeadline(dl)
+	}
+	if err = x.setup(xauth(num)); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("x11 setup: %w", err)
+	}
+	c.SetDeadline(time.Time{})
+	return x, nil
+}
+
+// setup performs the connection setup.
+func (x *xconn) setup(cookie []byte) error {
+	var name []byte
+	if cookie != nil {
+		name = []byte(x11AuthName)
+	}
+	b := make([]byte, 12+pad4(len(name))+pad4(len(cookie)))
+	b[0] = 'l'
+	x11Order.PutUint16(b[2:], 11) // protocol version 11.0
+	x11Order.PutUint16(b[6:], uint16(len(name)))
+	x11Order.PutUint16(b[8:], uint16(len(cookie)))
+	copy(b[12:], name)
+	copy(b[12+pad4(len(name)):], cookie)
+	if _, err := x.c.Write(b); err != nil {
+		return err
+	}
+	var hdr [8]byte
+	if _, err := io.ReadFull(x.r, hdr[:]); err != nil {
+		return err
+	}
+	data := make([]byte, 4*int(x11Order.Uint16(hdr[6:])))
+	if _, err := io.ReadFull(x.r, data); err != nil {
+		return err
+	}
+	switch hdr[0] {
+	case 0: // failed
+		n := int(hdr[1])
+		if n > len(data) {
+			n = len(data)
+		}
+		return fmt.Errorf("connection refused: %s", data[:n])
+	case 2: // authenticate
+		return fmt.Errorf("authentication required: %s",
+			strings.TrimRight(string(data), "\x00"))
+	}
+	if len(data) < 32 {
+		return errors.New("short reply")
+	}
+	off := 32 + pad4(int(x11Order.Uint16(data[16:]))) + 8*int(data[21])
+	if data[20] == 0 || len(data) < off+4 {
+		return errors.New("no screens")
+	}
+	x.root = x11Order.Uint32(data[off:])
+	return nil
+}
+
+// request writes a request.  data is padded to a multiple of 4.
+func (x *xconn) request(major, minor byte, data ...byte) error {
+	b := make([]byte, 4+pad4(len(data)))
+	b[0], b[1] = major, minor
+	x11Order.PutUint16(b[2:], uint16(len(b)/4))
+	copy(b[4:], data)
+	_, err := x.c.Write(b)
+	return err
+}
+
+// read reads a server message: an error, a reply or an event.
+func (x *xconn) read() ([]byte, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(x.r, b); err != nil {
+		return nil, err
+	}
+	if b[0] == x11Reply {
+		if n := x11Order.Uint32(b[4:]); n > 0 {
+			b = append(b, make([]byte, 4*int(n))...)
+			if _, err := io.ReadFull(x.r, b[32:]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b, nil
+}
+
+// reply reads messages until a reply or an error is received,
+// discarding events.
+func (x *xconn) reply() ([]byte, error) {
+	for {
+		b, err := x.read()
+		if err != nil {
+			return nil, err
+		}
+		switch b[0] {
+		case x11Error:
+			return nil, fmt.Errorf("x11: error %d, opcode %d.%d",
+				b[1], b[10], x11Order.Uint16(b[8:]))
+		case x11Reply:
+			return b, nil
+		}
+	}
+}
+
+// sync waits for the server to process the preceding requests.
+func (x *xconn) sync() error {
+	if err := x.request(x11GetInputFocus, 0); err != nil {
+		return err
+	}
+	_, err := x.reply()
+	return err
+}
+
+// X11Activate activates the X screen saver, like "xset s
+// activate".  It can be used as Reactor.Start: it connects in the
+// background, and the status is sent to stopped after the server
+// has processed the request.
+func X11Activate(stopped chan<- error) error {
+	go func() { stopped <- x11Activate() }()
+	return nil
+}
+
+// x11Activate connects to the X server and activates the screen
+// saver.
+func x11Activate() error {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		defaultTimeout)
+	defer cancel()
+	x, err := dialX11(ctx)
+	if err != nil {
+		return err
+	}
+	defer x.c.Close()
+	err = x.request(x11ForceSS, 1) // ScreenSaverActive
+	if err == nil {
+		err = x.sync()
+	}
+	return err
+}
+
+/*
+X11Backend generates lock events when the X screen saver is
+activated, as reported by the MIT-SCREEN-SAVER extension, for X11
+sessions without idle support in logind.  The X server is the one
+given by $DISPLAY.  No D-Bus connection is needed; instead,
+screen saver notify events are passed to Handle as signals.
+*/
+type X11Backend struct {
+	x     *xconn
+	event byte // ScreenSaverNotify event code
+	sc    chan *dbus.Signal
+	done  chan struct{}
+}
+
+// NewX11Backend connects to the X server and selects screen
+// saver notify events on the root window.
+func NewX11Backend(ctx context.Context) (Backend, error) {
+	x, err := dialX11(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		x.c.SetDeadline(dl)
+	}
+	be := &X11Backend{
+		x:    x,
+		sc:   make(chan *dbus.Signal, 4),
+		done: make(chan struct{}),
+	}
+	if err = be.selectInput(); err != nil {
+		x.c.Close()
+		return nil, err
+	}
+	x.c.SetDeadline(time.Time{})
+	debugln("x11: watching root window", x.root)
+	go be.read()
+	return be, nil
+}
+
+// selectInput queries the extension and selects events.
+func (be *X11Backend) selectInput() error {
+	x := be.x
+	b := make([]byte, 4+len(x11SSExt))
+	x11Order.PutUint16(b, uint16(len(x11SSExt)))
+	copy(b[4:], x11SSExt)
+	if err := x.request(x11QueryExtension, 0, b...); err != nil {
+		return err
+	}
+	b, err := x.reply()
+	if err != nil {
+		return err
+	} else if b[8] == 0 {
+		return ErrX11NoSS
+	}
+	major := b[9]
+	be.event = b[10]
+	if err = x.request(major, x11SSQueryVersion, 1, 1); err != nil {
+		return err
+	} else if _, err = x.reply(); err != nil {
+		return err
+	}
+	b = make([]byte, 8)
+	x11Order.PutUint32(b, x.root)
+	x11Order.PutUint32(b[4:], x11SSNotifyMask)
+	if err = x.request(major, x11SSSelectInput, b...); err != nil {
+		return err
+	}
+	return x.sync()
+}
+
+func (*X11Backend) Name() string                    { return "x11" }
+func (*X11Backend) Filter() string                  { return "none" }
+func (be *X11Backend) Signals() <-chan *dbus.Signal { return be.sc }
+func (*X11Backend) Release() error                  { return nil }
+
+func (*X11Backend) MaxInhibit() (time.Duration, error) {
+	return -1, nil
+}
+
+// read reads events from the X server until the connection is
+// closed.
+func (be *X11Backend) read() {
+	defer close(be.sc)
+	for {
+		b, err := be.x.read()
+		if err != nil {
+			select {
+			case <-be.done:
+			default:
+				logln("x11:", err)
+			}
+			return
+		}
+		if b[0] == x11Error {
+			logln("x11: error", b[1])
+			continue
+		} else if b[0]&0x7f != be.event {
+			continue
+		}
+		sig := &dbus.Signal{
+			Name: x11SigName,
+			Body: []interface{}{b[1]}, // state
+		}
+		select {
+		case be.sc <- sig:
+		case <-be.done:
+			return
+		}
+	}
+}
+
+func (be *X11Backend) Handle(sig *dbus.Signal) (Event, error) {
+	if sig.Name != x11SigName || len(sig.Body) < 1 {
+		return None, ErrDBusSignal
+	}
+	if state, _ := sig.Body[0].(byte); state != x11SSOn {
+		return None, nil
+	}
+	return Lock, nil
+}
+
+func (be *X11Backend) Close() error {
+	close(be.done)
+	return be.x.c.Close()
+}
@@ -0,0 +1,297 @@
+/*
+ * Copyright (c) 2026 Vadim Vygonets <vadik@vygo.net>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package reactor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+func TestParseDisplay(t *testing.T) {
+	for _, v := range []struct {
+		display, network, addr, num string
+		ok                          bool
+	}{
+		{":0", "unix", "/tmp/.X11-unix/X0", "0", true},
+		{":1.0", "unix", "/tmp/.X11-unix/X1", "1", true},
+		{"unix:12", "unix", "/tmp/.X11-unix/X12", "12", true},
+		{"localhost:2", "tcp", "localhost:6002", "2", true},
+		{"10.0.0.1:0.1", "tcp", "10.0.0.1:6000", "0", true},
+		{"::1:3", "tcp", "[::1]:6003", "3", true},
+		{"", "", "", "", false},
+		{"localhost", "", "", "", false},
+		{":", "", "", "", false},
+		{":x", "", "", "", false},
+		{":-1", "", "", "", false},
+	} {
+		network, addr, num, err := parseDisplay(v.display)
+		if (err == nil) != v.ok {
+			t.Errorf("parseDisplay(%q): error %v", v.display, err)
+		} else if network != v.network || addr != v.addr || num != v.num {
+			t.Errorf("parseDisplay(%q) = %q, %q, %q, want %q, %q, %q",
+				v.display, network, addr, num,
+				v.network, v.addr, v.num)
+		}
+	}
+}
+
+// xauthEntry returns an Xauthority file entry.
+func xauthEntry(family uint16, fields ...string) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, family)
+	for _, v := range fields {
+		binary.Write(&b, binary.BigEndian, uint16(len(v)))
+		b.WriteString(v)
+	}
+	return b.Bytes()
+}
+
+func TestXauth(t *testing.T) {
+	hostname, _ := os.Hostname()
+	var b bytes.Buffer
+	b.Write(xauthEntry(256, "otherhost", "0", x11AuthName, "other"))
+	b.Write(xauthEntry(256, hostname, "0", "XDM-AUTHORIZATION-1", "xdm"))
+	b.Write(xauthEntry(256, hostname, "0", x11AuthName, "zero"))
+	b.Write(xauthEntry(65535, "", "", x11AuthName, "wild"))
+	name := filepath.Join(t.TempDir(), "Xauthority")
+	if err := os.WriteFile(name, b.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XAUTHORITY", name)
+	for num, want := range map[string]string{"0": "zero", "1": "wild"} {
+		if got := string(xauth(num)); got != want {
+			t.Errorf("xauth(%q) = %q, want %q", num, got, want)
+		}
+	}
+	// truncated file
+	os.WriteFile(name, b.Bytes()[:10], 0600)
+	if got := xauth("0"); got != nil {
+		t.Errorf("xauth from truncated file = %q, want nil", got)
+	}
+	t.Setenv("XAUTHORITY", filepath.Join(t.TempDir(), "none"))
+	if got := xauth("0"); got != nil {
+		t.Errorf("xauth without file = %q, want nil", got)
+	}
+}
+
+// setupReply returns a successful connection setup reply with the
+// given vendor, number of pixmap formats and root window.
+func setupReply(vendor string, formats int, root uint32) []byte {
+	off := 32 + pad4(len(vendor)) + 8*formats
+	data := make([]byte, off+40) // one screen
+	x11Order.PutUint16(data[16:], uint16(len(vendor)))
+	data[20], data[21] = 1, byte(formats)
+	copy(data[32:], vendor)
+	x11Order.PutUint32(data[off:], root)
+	hdr := make([]byte, 8)
+	hdr[0] = 1
+	x11Order.PutUint16(hdr[2:], 11)
+	x11Order.PutUint16(hdr[6:], uint16(len(data)/4))
+	return append(hdr, data...)
+}
+
+// failReply returns a failed or authenticate setup reply.
+func failReply(code byte, reason string) []byte {
+	data := make([]byte, pad4(len(reason)))
+	copy(data, reason)
+	hdr := make([]byte, 8)
+	hdr[0], hdr[1] = code, byte(len(reason))
+	x11Order.PutUint16(hdr[6:], uint16(len(data)/4))
+	return append(hdr, data...)
+}
+
+func TestSetup(t *testing.T) {
+	for _, v := range []struct {
+		name   string
+		cookie []byte
+		reply  []byte
+		root   uint32
+		err    string
+	}{
+		{"plain", nil, setupReply("Test", 2, 0x1234), 0x1234, ""},
+		{"odd vendor", []byte("cookie"),
+			setupReply("The X.Org Foundation", 7, 0x4321), 0x4321, ""},
+		{"refused", nil, failReply(0, "no way"), 0,
+			"connection refused: no way"},
+		{"authenticate", nil, failReply(2, "who are you"), 0,
+			"authentication required: who are you"},
+		{"no screens", nil, func() []byte {
+			b := setupReply("Test", 0, 1)
+			b[8+20] = 0
+			return b
+		}(), 0, "no screens"},
+		{"short", nil, setupReply("", 0, 1)[:8+32], 0, "EOF"},
+	} {
+		c, s := net.Pipe()
+		go func() {
+			defer s.Close()
+			hdr := make([]byte, 12)
+			if _, err := io.ReadFull(s, hdr); err != nil {
+				return
+			}
+			n := pad4(int(x11Order.Uint16(hdr[6:]))) +
+				pad4(int(x11Order.Uint16(hdr[8:])))
+			req := make([]byte, n)
+			if _, err := io.ReadFull(s, req); err != nil {
+				return
+			}
+			if hdr[0] != 'l' || x11Order.Uint16(hdr[2:]) != 11 ||
+				!bytes.Contains(req, v.cookie) {
+				s.Write(failReply(0, "bad request"))
+				return
+			}
+			s.Write(v.reply)
+		}()
+		x := &xconn{c: c, r: bufio.NewReader(c)}
+		err := x.setup(v.cookie)
+		c.Close()
+		if v.err != "" {
+			if err == nil || !strings.Contains(err.Error(), v.err) {
+				t.Errorf("%s: error %v, want %q", v.name, err, v.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", v.name, err)
+		} else if x.root != v.root {
+			t.Errorf("%s: root %#x, want %#x", v.name, x.root, v.root)
+		}
+	}
+}
+
+func TestX11Handle(t *testing.T) {
+	var be X11Backend
+	for _, v := range []struct {
+		body []interface{}
+		ev   Event
+		err  error
+	}{
+		{[]interface{}{byte(x11SSOn)}, Lock, nil},
+		{[]interface{}{byte(0)}, None, nil}, // off
+		{[]interface{}{byte(2)}, None, nil}, // cycle
+		{nil, None, ErrDBusSignal},
+	} {
+		ev, err := be.Handle(&dbus.Signal{Name: x11SigName, Body: v.body})
+		if ev != v.ev || err != v.err {
+			t.Errorf("Handle(%v) = %v, %v, want %v, %v",
+				v.body, ev, err, v.ev, v.err)
+		}
+	}
+}
+
+// TestXvfb runs the X11 backend and action against Xvfb, if
+// installed.
+func TestXvfb(t *testing.T) {
+	xvfb, err := exec.LookPath("Xvfb")
+	if err != nil {
+		t.Skip("Xvfb not installed")
+	}
+	display := fmt.Sprintf(":%d", 90+os.Getpid()%9)
+	cmd := exec.Command(xvfb, display, "-nolisten", "tcp")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	t.Setenv("DISPLAY", display)
+	t.Setenv("XAUTHORITY", filepath.Join(t.TempDir(), "none"))
+	var be Backend
+	for i := 0; i < 50; i++ { // wait for Xvfb
+		ctx, cancel := context.WithTimeout(context.Background(),
+			time.Second)
+		be, err = NewX11Backend(ctx)
+		cancel()
+		if err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer be.Close()
+	stopped := make(chan error, 1)
+	if err := X11Activate(stopped); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatal("X11Activate:", err)
+	}
+	select {
+	case sig := <-be.Signals():
+		if ev, err := be.Handle(sig); ev != Lock || err != nil {
+			t.Errorf("Handle = %v, %v, want lock", ev, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("no screen saver notify event")
+	}
+}
+
+func TestX11ActivateAsync(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	if port < 6000 {
+		t.Skip("port below 6000")
+	}
+	t.Setenv("DISPLAY", fmt.Sprintf("127.0.0.1:%d", port-6000))
+	t.Setenv("XAUTHORITY", filepath.Join(t.TempDir(), "missing"))
+
+	// the server doesn't answer the setup until closed
+	stopped := make(chan error, 1)
+	begin := time.Now()
+	if err := X11Activate(stopped); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(begin); d > 100*time.Millisecond {
+		t.Errorf("X11Activate took %v", d)
+	}
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-stopped:
+		t.Fatal("completed before setup:", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	c.Close()
+	select {
+	case err := <-stopped:
+		if err == nil {
+			t.Error("succeeded without X server")
+		}
+	case <-time.After(time.Second):
+		t.Error("no status after connection closed")
+	}
+}
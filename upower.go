@@ -1,58 +0,0 @@
-/*
- * Copyright (c) 2013, 2024 Vadim Vygonets <vadik@vygo.net>
- *
- * Permission to use, copy, modify, and distribute this software for any
- * purpose with or without fee is hereby granted, provided that the above
- * copyright notice and this permission notice appear in all copies.
- *
- * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
- * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
- * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
- * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
- * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
- * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
- * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
- */
-
-package main
-
-import (
-	"time"
-
-	dbus "github.com/godbus/dbus/v5"
-)
-
-const (
-	upDest    = "org.freedesktop.UPower"
-	upPath    = "/org/freedesktop/UPower"
-	upIface   = upDest
-	upSignal  = "NotifySleep"
-	upSigName = upDest + "." + upSignal
-	upTest    = upDest + ".SuspendAllowed"
-	upFilter  = "type='signal',interface='" + upDest + "',member=" +
-		upSignal
-)
-
-type UPowerBackend struct{}
-
-func NewUPowerBackend(conn *dbus.Conn) Backend {
-	if conn.Object(upDest, upPath).Call(upTest, 0).Err != nil {
-		return nil
-	}
-	return UPowerBackend{}
-}
-
-func (UPowerBackend) Name() string   { return "UPower" }
-func (UPowerBackend) Filter() string { return upFilter }
-func (UPowerBackend) Release() error { return nil }
-
-func (UPowerBackend) Handle(sig *dbus.Signal) (bool, error) {
-	if sig.Path != upPath || sig.Name != upSigName {
-		return false, ErrDBusSignal
-	}
-	return true, nil
-}
-
-func (UPowerBackend) MaxInhibit() (time.Duration, error) {
-	return -1, nil
-}